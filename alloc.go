@@ -0,0 +1,34 @@
+package superdog
+
+import (
+	"errors"
+)
+
+// ErrMlockUnsupported is returned by NewMlockAllocator on platforms without mlock support.
+var ErrMlockUnsupported = errors.New("Locked memory is not supported on this platform")
+
+// Allocator provides the memory key and salt bytes are kept in.
+type Allocator interface {
+	Alloc(n int) ([]byte, error)
+	// Free releases a buffer returned by Alloc. The buffer has already been wiped.
+	Free(b []byte)
+}
+
+// KeyAllocator provides the memory NewKey keeps key bytes in, and providers keep cached salts in.
+// It defaults to the Go heap. Set it before any keys are created.
+var KeyAllocator Allocator = heapAllocator{}
+
+type heapAllocator struct{}
+
+func (heapAllocator) Alloc(n int) ([]byte, error) {
+	return make([]byte, n), nil
+}
+
+func (heapAllocator) Free(b []byte) {}
+
+// Wipe overwrites b with zeros.
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
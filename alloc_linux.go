@@ -0,0 +1,45 @@
+package superdog
+
+import (
+	"os"
+	"syscall"
+)
+
+// madvDontDump excludes a mapping from core dumps. It is not defined by package syscall.
+const madvDontDump = 0x10
+
+type mlockAllocator struct {
+	pageSize int
+}
+
+// NewMlockAllocator returns an Allocator whose buffers are locked into memory, so they are never written to swap, and
+// excluded from core dumps. Each buffer takes at least one page, and the total is limited by RLIMIT_MEMLOCK.
+//
+//	superdog.KeyAllocator, err = superdog.NewMlockAllocator()
+func NewMlockAllocator() (Allocator, error) {
+	return mlockAllocator{pageSize: os.Getpagesize()}, nil
+}
+
+func (a mlockAllocator) Alloc(n int) ([]byte, error) {
+	size := (n + a.pageSize - 1) / a.pageSize * a.pageSize
+	if size == 0 {
+		size = a.pageSize
+	}
+
+	b, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANON)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Mlock(b); err != nil {
+		syscall.Munmap(b)
+		return nil, err
+	}
+	syscall.Madvise(b, madvDontDump)
+	return b[:n], nil
+}
+
+func (a mlockAllocator) Free(b []byte) {
+	b = b[:cap(b)]
+	syscall.Munlock(b)
+	syscall.Munmap(b)
+}
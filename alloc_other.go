@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package superdog
+
+// NewMlockAllocator returns ErrMlockUnsupported; locked memory is only implemented on Linux.
+func NewMlockAllocator() (Allocator, error) {
+	return nil, ErrMlockUnsupported
+}
@@ -0,0 +1,103 @@
+package superdog
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestKeyDestroy(t *testing.T) {
+	raw := bytes.Repeat([]byte{7}, 32)
+	k, err := NewKey(1, AES, GCM, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := k.Encrypt(nil, []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	retained := k.key
+	k.Destroy()
+	k.Destroy()
+
+	if !bytes.Equal(retained, make([]byte, 32)) {
+		t.Fatal("Expected key bytes to be wiped")
+	}
+	if k.Bytes() != nil {
+		t.Fatal("Expected no key bytes after Destroy")
+	}
+	if _, err := k.Encrypt(nil, []byte("value")); err != ErrKeyDestroyed {
+		t.Fatal("Expected destroyed key error, got", err)
+	}
+	if _, err := k.Decrypt(nil, b[8:]); err != ErrKeyDestroyed {
+		t.Fatal("Expected destroyed key error, got", err)
+	}
+}
+
+// destroyingProvider returns a key that has already been destroyed the first time, as a provider evicting its cache
+// between GetKey and its use would.
+type destroyingProvider struct {
+	calls int
+}
+
+func (p *destroyingProvider) GetKey(prefix string, version uint64) (*Key, error) {
+	k, err := NewKey(version, AES, GCM, bytes.Repeat([]byte{7}, 32))
+	p.calls++
+	if p.calls == 1 {
+		k.Destroy()
+	}
+	return k, err
+}
+
+func (p *destroyingProvider) CurrentKeyVersion(prefix string) (uint64, error) {
+	return 1, nil
+}
+
+func TestEncryptRefetchesDestroyedKey(t *testing.T) {
+	defer func(kp KeyProvider) { DefaultKeyProvider = kp }(DefaultKeyProvider)
+	DefaultKeyProvider = &destroyingProvider{}
+
+	b, err := Encrypt("test", nil, []byte("value"))
+	if err != nil {
+		t.Fatal("Expected destroyed key to be fetched again", err)
+	}
+	plain, err := Decrypt("test", b, b)
+	if err != nil || string(plain) != "value" {
+		t.Fatal("Expected round trip", err)
+	}
+}
+
+func TestMlockAllocator(t *testing.T) {
+	a, err := NewMlockAllocator()
+	if err == ErrMlockUnsupported {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := a.Alloc(32)
+	if err != nil {
+		t.Skip("mlock not permitted:", err)
+	}
+	if len(b) != 32 {
+		t.Fatal("Expected a 32 byte buffer, got", len(b))
+	}
+	a.Free(b)
+
+	defer func(a Allocator) { KeyAllocator = a }(KeyAllocator)
+	KeyAllocator = a
+
+	k, err := NewKey(1, AES, GCM, bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, err := k.Encrypt(nil, []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain, err := k.Decrypt(nil, enc[8:]); err != nil || string(plain) != "value" {
+		t.Fatal("Expected round trip with a locked key", err)
+	}
+	k.Destroy()
+}
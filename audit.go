@@ -0,0 +1,96 @@
+package superdog
+
+import (
+	"context"
+	"time"
+)
+
+// Audited operations, besides OpDecrypt and OpReencrypt.
+const (
+	OpGetKey = "get_key"
+	OpRotate = "rotate"
+)
+
+// Audit outcomes.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Principal identifies who an operation is made for, and why. It is passed to the Context variants of the package
+// functions with WithPrincipal, and recorded in their audit events.
+type Principal struct {
+	Service string // The calling service
+	Name    string // The user or client the service acts for
+	Purpose string // Why the data is accessed, e.g. "support ticket 1234"
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the Principal carried by ctx, or the zero Principal.
+func PrincipalFrom(ctx context.Context) Principal {
+	p, _ := ctx.Value(principalKey{}).(Principal)
+	return p
+}
+
+// AuditEvent records one key fetch, decryption, reencryption or key rotation.
+type AuditEvent struct {
+	Time         time.Time `json:"time"`
+	Op           string    `json:"op"`
+	Prefix       string    `json:"prefix"`
+	KeyVersion   uint64    `json:"key_version"`
+	ToKeyVersion uint64    `json:"to_key_version,omitempty"` // The version a reencryption encrypted with
+	Outcome      string    `json:"outcome"`
+	ErrorType    string    `json:"error_type,omitempty"` // ErrorType of the failure
+	Error        string    `json:"error,omitempty"`
+	Service      string    `json:"service,omitempty"`
+	Principal    string    `json:"principal,omitempty"`
+	Purpose      string    `json:"purpose,omitempty"`
+}
+
+// AuditSink receives audit events. Implementations must be safe for concurrent use. Audit is called on the path of
+// the audited operation, so slow sinks should be wrapped in audit.Async.
+type AuditSink interface {
+	Audit(e AuditEvent)
+}
+
+// DefaultAuditSink receives the audit events of the package functions and providers. It is nil, disabling
+// auditing, by default.
+var DefaultAuditSink AuditSink
+
+// Audit sends an event for op on the key version of prefix to DefaultAuditSink, attributed to the Principal in ctx.
+// It is meant for providers reporting key rotations.
+func Audit(ctx context.Context, op, prefix string, version uint64, err error) {
+	audit(ctx, op, prefix, version, 0, err)
+}
+
+func audit(ctx context.Context, op, prefix string, version, to uint64, err error) {
+	sink := DefaultAuditSink
+	if sink == nil {
+		return
+	}
+
+	p := PrincipalFrom(ctx)
+	e := AuditEvent{
+		Time:         time.Now().UTC(),
+		Op:           op,
+		Prefix:       prefix,
+		KeyVersion:   version,
+		ToKeyVersion: to,
+		Outcome:      OutcomeSuccess,
+		Service:      p.Service,
+		Principal:    p.Name,
+		Purpose:      p.Purpose,
+	}
+	if err != nil {
+		e.Outcome = OutcomeFailure
+		e.ErrorType = ErrorType(err)
+		e.Error = err.Error()
+	}
+	sink.Audit(e)
+}
@@ -0,0 +1,84 @@
+package audit
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xordataexchange/superdog"
+)
+
+var _ superdog.AuditSink = &Async{}
+
+// Async is an AuditSink that queues events and passes them to another sink from a background goroutine, so Audit
+// never blocks. Events audited while the queue is full are dropped.
+type Async struct {
+	// OnDrop is called with every event dropped because the queue was full. It must not block.
+	OnDrop func(e superdog.AuditEvent)
+
+	sink    superdog.AuditSink
+	events  chan superdog.AuditEvent
+	done    chan struct{}
+	dropped uint64
+	closed  bool
+	l       sync.RWMutex
+}
+
+// NewAsync returns an Async passing events to sink, queueing up to size of them.
+func NewAsync(sink superdog.AuditSink, size int) *Async {
+	a := &Async{
+		sink:   sink,
+		events: make(chan superdog.AuditEvent, size),
+		done:   make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *Async) run() {
+	defer close(a.done)
+	for e := range a.events {
+		a.sink.Audit(e)
+	}
+}
+
+func (a *Async) Audit(e superdog.AuditEvent) {
+	a.l.RLock()
+	defer a.l.RUnlock()
+
+	if !a.closed {
+		select {
+		case a.events <- e:
+			return
+		default:
+		}
+	}
+	atomic.AddUint64(&a.dropped, 1)
+	if a.OnDrop != nil {
+		a.OnDrop(e)
+	}
+}
+
+// Dropped returns the number of events dropped so far.
+func (a *Async) Dropped() uint64 {
+	return atomic.LoadUint64(&a.dropped)
+}
+
+// Close stops accepting events, waits until the queued events have been passed to the sink, and closes the sink
+// if it is an io.Closer. Events audited afterwards are dropped.
+func (a *Async) Close() error {
+	a.l.Lock()
+	if a.closed {
+		a.l.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.events)
+	a.l.Unlock()
+
+	<-a.done
+	if c, ok := a.sink.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
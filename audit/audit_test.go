@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/xordataexchange/superdog"
+	"github.com/xordataexchange/superdog/superdogtest"
+)
+
+func TestFileSink(t *testing.T) {
+	defer func(s superdog.AuditSink) { superdog.DefaultAuditSink = s }(superdog.DefaultAuditSink)
+	m := superdogtest.NewMemoryProvider()
+	m.Rotate("ssn")
+	m.Rotate("ssn")
+	defer m.Install()()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	f, err := OpenFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := NewAsync(f, 16)
+	superdog.DefaultAuditSink = sink
+
+	ctx := superdog.WithPrincipal(context.Background(), superdog.Principal{Service: "billing", Name: "alice", Purpose: "refund"})
+	b, _ := superdog.EncryptContext(ctx, "ssn", nil, []byte("value"))
+	if _, err := superdog.DecryptContext(ctx, "ssn", nil, b); err != nil {
+		t.Fatal(err)
+	}
+	superdog.DecryptContext(ctx, "ssn", nil, []byte{9, 0, 0, 0, 0, 0, 0, 0, 1})
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var events []superdog.AuditEvent
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var e superdog.AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal("Expected a JSON object per line", err)
+		}
+		events = append(events, e)
+	}
+
+	// encrypt fetches the key; each decrypt fetches it and decrypts, the last one failing on a truncated ciphertext
+	if len(events) != 5 {
+		t.Fatal("Expected 5 events, got", len(events))
+	}
+	d := events[2]
+	if d.Op != superdog.OpDecrypt || d.Prefix != "ssn" || d.KeyVersion != 2 || d.Outcome != superdog.OutcomeSuccess {
+		t.Fatal("Unexpected decrypt event", d)
+	}
+	if d.Service != "billing" || d.Principal != "alice" || d.Purpose != "refund" || d.Time.IsZero() {
+		t.Fatal("Expected the principal to be recorded", d)
+	}
+	if e := events[4]; e.Op != superdog.OpDecrypt || e.KeyVersion != 9 || e.Outcome != superdog.OutcomeFailure {
+		t.Fatal("Expected the failed decrypt to be recorded", e)
+	}
+}
+
+// blocked is a sink that waits until it is released.
+type blocked struct {
+	release chan struct{}
+	l       sync.Mutex
+	n       int
+}
+
+func (b *blocked) Audit(e superdog.AuditEvent) {
+	<-b.release
+	b.l.Lock()
+	defer b.l.Unlock()
+	b.n++
+}
+
+func TestAsyncDrops(t *testing.T) {
+	b := &blocked{release: make(chan struct{})}
+	a := NewAsync(b, 1)
+	var dropped int
+	a.OnDrop = func(superdog.AuditEvent) { dropped++ }
+
+	// one event is held by the blocked sink and one queued; the rest can not wait
+	for i := 0; i < 5; i++ {
+		a.Audit(superdog.AuditEvent{Op: superdog.OpDecrypt})
+	}
+	if a.Dropped() < 3 || dropped != int(a.Dropped()) {
+		t.Fatal("Expected events to be dropped instead of blocking", a.Dropped(), dropped)
+	}
+
+	close(b.release)
+	a.Close()
+	if uint64(b.n)+a.Dropped() != 5 {
+		t.Fatal("Expected queued events to be delivered on close", b.n, a.Dropped())
+	}
+	a.Audit(superdog.AuditEvent{})
+	if a.Dropped() != uint64(5-b.n+1) {
+		t.Fatal("Expected events after close to be dropped")
+	}
+}
@@ -0,0 +1,20 @@
+/*
+See LICENSE file for license details
+Copyright (c) 2015 XOR Data Exchange, Inc.
+
+
+Package audit provides sinks for superdog's audit events. A FileSink appends them to a file as JSON lines, and Async
+queues them for another sink so auditing does not slow down encryption:
+
+	f, err := audit.OpenFile("/var/log/myapp/superdog-audit.log")
+	if err != nil {
+		log.Fatal(err)
+	}
+	sink := audit.NewAsync(f, 1024)
+	defer sink.Close()
+	superdog.DefaultAuditSink = sink
+
+Events are attributed to the superdog.Principal passed with superdog.WithPrincipal to the Context variants of the
+package functions, e.g. superdog.DecryptContext.
+*/
+package audit
@@ -0,0 +1,53 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/xordataexchange/superdog"
+)
+
+var _ superdog.AuditSink = &FileSink{}
+
+// FileSink appends audit events to a file, one JSON object per line.
+type FileSink struct {
+	// OnError is called when an event can not be written.
+	OnError func(err error)
+
+	l   sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// OpenFile returns a FileSink appending to the file at path, which is created readable only by its owner if it does
+// not exist.
+func OpenFile(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (s *FileSink) Audit(e superdog.AuditEvent) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if err := s.enc.Encode(e); err != nil && s.OnError != nil {
+		s.OnError(err)
+	}
+}
+
+// Sync flushes written events to disk.
+func (s *FileSink) Sync() error {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.f.Sync()
+}
+
+// Close closes the file. Events audited afterwards are reported to OnError.
+func (s *FileSink) Close() error {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.f.Close()
+}
@@ -0,0 +1,60 @@
+package superdog
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// auditLog is an AuditSink keeping the events it receives.
+type auditLog struct {
+	l      sync.Mutex
+	events []AuditEvent
+}
+
+func (a *auditLog) Audit(e AuditEvent) {
+	a.l.Lock()
+	defer a.l.Unlock()
+	a.events = append(a.events, e)
+}
+
+func TestAuditReencrypt(t *testing.T) {
+	defer func(kp KeyProvider) { DefaultKeyProvider = kp }(DefaultKeyProvider)
+	defer func(s AuditSink) { DefaultAuditSink = s }(DefaultAuditSink)
+	kp := &DevDerivedKeyProvider{DisableWarn: true, KeyVersion: 1}
+	DefaultKeyProvider = kp
+
+	b, _ := Encrypt("ssn", nil, []byte("value"))
+	kp.KeyVersion = 2
+	sink := &auditLog{}
+	DefaultAuditSink = sink
+
+	ctx := WithPrincipal(context.Background(), Principal{Service: "rotator", Purpose: "key rotation"})
+	if _, err := ReencryptContext(ctx, "ssn", nil, b); err != nil {
+		t.Fatal(err)
+	}
+	Audit(ctx, OpRotate, "ssn", 3, nil)
+
+	if len(sink.events) != 4 {
+		t.Fatal("Expected 4 events, got", sink.events)
+	}
+	if e := sink.events[0]; e.Op != OpGetKey || e.KeyVersion != 1 || e.Service != "rotator" {
+		t.Fatal("Expected the old key fetch to be audited", e)
+	}
+	if e := sink.events[2]; e.Op != OpReencrypt || e.KeyVersion != 1 || e.ToKeyVersion != 2 || e.Outcome != OutcomeSuccess || e.Purpose != "key rotation" {
+		t.Fatal("Unexpected reencrypt event", e)
+	}
+	if e := sink.events[3]; e.Op != OpRotate || e.KeyVersion != 3 {
+		t.Fatal("Unexpected rotation event", e)
+	}
+}
+
+func TestPrincipalFrom(t *testing.T) {
+	if p := PrincipalFrom(context.Background()); p != (Principal{}) {
+		t.Fatal("Expected no principal", p)
+	}
+	p := Principal{Service: "billing", Name: "alice", Purpose: "refund"}
+	if got := PrincipalFrom(WithPrincipal(context.Background(), p)); got != p {
+		t.Fatal("Expected principal to be carried", got)
+	}
+}
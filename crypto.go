@@ -2,10 +2,11 @@ package superdog
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/binary"
-	"errors"
+	"time"
 )
 
 var DefaultKeyProvider KeyProvider = new(DevKeyProvider)
@@ -13,62 +14,159 @@ var DefaultSaltProvider SaltProvider = new(DevSaltProvider)
 
 // Encrypt will encrypt the provided byte slice with the latesg key. It returns a new slice as it prepends the key version, and IV.
 func Encrypt(prefix string, dst, src []byte) ([]byte, error) {
-	v, err := DefaultKeyProvider.CurrentKeyVersion(prefix)
+	return EncryptContext(context.Background(), prefix, dst, src)
+}
+
+// EncryptContext is Encrypt, traced as a child of the span in ctx.
+func EncryptContext(ctx context.Context, prefix string, dst, src []byte) ([]byte, error) {
+	start := time.Now()
+	ctx, span := begin(ctx, "superdog.Encrypt", prefix)
+	v, err := currentKeyVersion(ctx, prefix)
 	if err != nil {
+		finish(span, OpEncrypt, prefix, 0, nil, start, err)
 		return nil, err
 	}
-	return EncryptWithVersion(prefix, v, dst, src)
+	b, k, err := encrypt(ctx, prefix, v, dst, src)
+	finish(span, OpEncrypt, prefix, v, k, start, err)
+	return b, err
 }
 
 // EncryptWithVersion will encrypt the provided byte slice with the supplied key version. It returns a new slice as it prepends the key version, and IV.
 func EncryptWithVersion(keyPrefix string, keyVersion uint64, dst []byte, src []byte) ([]byte, error) {
+	return EncryptWithVersionContext(context.Background(), keyPrefix, keyVersion, dst, src)
+}
+
+// EncryptWithVersionContext is EncryptWithVersion, traced as a child of the span in ctx.
+func EncryptWithVersionContext(ctx context.Context, keyPrefix string, keyVersion uint64, dst []byte, src []byte) ([]byte, error) {
+	start := time.Now()
+	ctx, span := begin(ctx, "superdog.Encrypt", keyPrefix)
+	b, k, err := encrypt(ctx, keyPrefix, keyVersion, dst, src)
+	finish(span, OpEncrypt, keyPrefix, keyVersion, k, start, err)
+	return b, err
+}
+
+// encrypt implements EncryptWithVersion, also returning the key used if it was fetched.
+func encrypt(ctx context.Context, keyPrefix string, keyVersion uint64, dst []byte, src []byte) ([]byte, *Key, error) {
 	if len(src) == 0 {
-		return dst[:0], nil
+		return dst[:0], nil, nil
 	}
 
-	k, err := DefaultKeyProvider.GetKey(keyPrefix, keyVersion)
-	if err != nil {
-		return nil, err
-	}
+	// a key evicted and destroyed by its provider after it was returned is fetched again, once, and the message is
+	// only counted the first time
+	for retry := true; ; retry = false {
+		k, err := getKey(ctx, keyPrefix, keyVersion)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := PolicyFor(keyPrefix).CheckEncrypt(keyPrefix, k); err != nil {
+			return nil, k, err
+		}
+		if retry {
+			if err := usageLimits.Load().count(keyPrefix, k); err != nil {
+				return nil, k, err
+			}
+		}
 
-	return k.Encrypt(dst, src)
+		b, err := k.Encrypt(dst, src)
+		if err == ErrKeyDestroyed && retry {
+			continue
+		}
+		return b, k, err
+	}
 }
 
 // Decrypt will decrypt the provided byte slice using the provided key at the version it was encrypted with. It returns a new slice as it trims the prefixed key version and IV. It modifies the same underlying array.
 func Decrypt(keyPrefix string, dst, src []byte) ([]byte, error) {
+	return DecryptContext(context.Background(), keyPrefix, dst, src)
+}
+
+// DecryptContext is Decrypt, traced as a child of the span in ctx.
+func DecryptContext(ctx context.Context, keyPrefix string, dst, src []byte) ([]byte, error) {
+	start := time.Now()
+	ctx, span := begin(ctx, "superdog.Decrypt", keyPrefix)
+	b, version, k, err := decrypt(ctx, keyPrefix, dst, src)
+	finish(span, OpDecrypt, keyPrefix, version, k, start, err)
+	audit(ctx, OpDecrypt, keyPrefix, version, 0, err)
+	return b, err
+}
+
+// decrypt implements Decrypt, also returning the key version the ciphertext names and the key if it was fetched.
+func decrypt(ctx context.Context, keyPrefix string, dst, src []byte) ([]byte, uint64, *Key, error) {
 	if len(src) == 0 {
-		return []byte{}, nil
+		return []byte{}, 0, nil, nil
 	}
 
 	if len(src) <= 8 {
-		return nil, errors.New("Insufficient length")
+		return nil, 0, nil, &Error{Prefix: keyPrefix, Err: ErrCiphertextTooShort}
 	}
 
 	buf := bytes.NewBuffer(src)
 	version, err := binary.ReadUvarint(buf)
 	if err != nil {
-		return src, err
+		return nil, 0, nil, &Error{Prefix: keyPrefix, Err: ErrCiphertextTooShort, Cause: err}
 	}
 
-	k, err := DefaultKeyProvider.GetKey(keyPrefix, version)
-	if err != nil {
-		return nil, err
-	}
+	for retry := true; ; retry = false {
+		k, err := getKey(ctx, keyPrefix, version)
+		if err != nil {
+			return nil, version, nil, err
+		}
 
-	return k.Decrypt(src, src[8:])
+		b, err := k.Decrypt(src, src[8:])
+		if err == ErrKeyDestroyed && retry {
+			continue
+		}
+		return b, version, k, keyError(keyPrefix, version, err)
+	}
 }
 
 // Reencrypt takes encrypted ciphertext, decrypts it with the version of the key used to decrypt it, and re-encrypts the plaintext with the current version of the key.
 func Reencrypt(keyPrefix string, dst, src []byte) ([]byte, error) {
-	dst, err := Decrypt(keyPrefix, dst, src)
+	return ReencryptContext(context.Background(), keyPrefix, dst, src)
+}
+
+// ReencryptContext is Reencrypt, traced as a child of the span in ctx.
+func ReencryptContext(ctx context.Context, keyPrefix string, dst, src []byte) ([]byte, error) {
+	start := time.Now()
+	ctx, span := begin(ctx, "superdog.Reencrypt", keyPrefix)
+	dst, version, k, err := decrypt(ctx, keyPrefix, dst, src)
 	if err != nil {
+		finish(span, OpReencrypt, keyPrefix, version, k, start, err)
+		audit(ctx, OpReencrypt, keyPrefix, version, 0, err)
 		return src, err
 	}
-	v, err := DefaultKeyProvider.CurrentKeyVersion(keyPrefix)
+	v, err := currentKeyVersion(ctx, keyPrefix)
 	if err != nil {
+		finish(span, OpReencrypt, keyPrefix, version, k, start, err)
+		audit(ctx, OpReencrypt, keyPrefix, version, 0, err)
 		return nil, err
 	}
-	return EncryptWithVersion(keyPrefix, v, dst, dst)
+	b, k, err := encrypt(ctx, keyPrefix, v, dst, dst)
+	finish(span, OpReencrypt, keyPrefix, v, k, start, err)
+	audit(ctx, OpReencrypt, keyPrefix, version, v, err)
+	return b, err
+}
+
+// getKey returns the key from DefaultKeyProvider, checked against the prefix's policy. The fetch is audited.
+func getKey(ctx context.Context, prefix string, version uint64) (*Key, error) {
+	var (
+		k   *Key
+		err error
+	)
+	if kp, ok := DefaultKeyProvider.(ContextKeyProvider); ok {
+		k, err = kp.GetKeyContext(ctx, prefix, version)
+	} else {
+		k, err = DefaultKeyProvider.GetKey(prefix, version)
+	}
+	err = keyError(prefix, version, err)
+	audit(ctx, OpGetKey, prefix, version, 0, err)
+	if err != nil {
+		return nil, err
+	}
+	if err := PolicyFor(prefix).CheckKey(prefix, version, k); err != nil {
+		return nil, err
+	}
+	return k, nil
 }
 
 // CurrentHashes returns a list of all possible hashes for the given prefix and value, used as search criteria during rotation
@@ -115,28 +213,70 @@ func CurrentHashesString(prefix string, value string) ([]string, error) {
 
 // Hash returns a hash to be used for the given value using the current version
 func Hash(prefix string, value []byte) ([]byte, error) {
-	v, err := DefaultSaltProvider.CurrentSaltVersion(prefix)
+	return HashContext(context.Background(), prefix, value)
+}
+
+// HashContext is Hash, traced as a child of the span in ctx.
+func HashContext(ctx context.Context, prefix string, value []byte) ([]byte, error) {
+	start := time.Now()
+	ctx, span := begin(ctx, "superdog.Hash", prefix)
+	var (
+		v   uint64
+		err error
+	)
+	if sp, ok := DefaultSaltProvider.(ContextSaltProvider); ok {
+		v, err = sp.CurrentSaltVersionContext(ctx, prefix)
+	} else {
+		v, err = DefaultSaltProvider.CurrentSaltVersion(prefix)
+	}
 	if err != nil {
+		finish(span, OpHash, prefix, 0, nil, start, err)
 		return nil, err
 	}
-	return HashWithVersion(prefix, v, value)
+	b, err := hash(ctx, prefix, v, value)
+	finish(span, OpHash, prefix, v, nil, start, err)
+	return b, err
 }
 
 // HashWithVersion returns a hash to be used for the given value using the supplied version
 func HashWithVersion(prefix string, version uint64, value []byte) ([]byte, error) {
+	return HashWithVersionContext(context.Background(), prefix, version, value)
+}
+
+// HashWithVersionContext is HashWithVersion, traced as a child of the span in ctx.
+func HashWithVersionContext(ctx context.Context, prefix string, version uint64, value []byte) ([]byte, error) {
+	start := time.Now()
+	ctx, span := begin(ctx, "superdog.Hash", prefix)
+	b, err := hash(ctx, prefix, version, value)
+	finish(span, OpHash, prefix, version, nil, start, err)
+	return b, err
+}
+
+func hash(ctx context.Context, prefix string, version uint64, value []byte) ([]byte, error) {
 	if len(value) == 0 {
 		return []byte{}, nil
 	}
-	s, err := DefaultSaltProvider.GetSalt(prefix, version)
+	var (
+		s   []byte
+		err error
+	)
+	if sp, ok := DefaultSaltProvider.(ContextSaltProvider); ok {
+		s, err = sp.GetSaltContext(ctx, prefix, version)
+	} else {
+		s, err = DefaultSaltProvider.GetSalt(prefix, version)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	hash := sha256.Sum256(append(s, value...))
+	// the salt may share memory with the provider, so it is not appended to
+	h := sha256.New()
+	h.Write(s)
+	h.Write(value)
 	i := base64.StdEncoding.EncodedLen(32)
 	out := make([]byte, i)
 
-	base64.StdEncoding.Encode(out, hash[:])
+	base64.StdEncoding.Encode(out, h.Sum(nil))
 
 	return out, nil
 }
@@ -63,5 +63,7 @@ Create a file with your connection routines in the init() function.  Add the bui
 
 Now compile your program with `go build -tags production` to include this code.  The `KeyProvider` will be set to use Vault.
 
+The same tag makes `superdog` refuse to use the development providers: `DevKeyProvider`, `DevSaltProvider` and `vault.DevVault` return `ErrDevProvider`, so a build that forgot to configure Vault fails instead of encrypting with well-known keys.  Outside of the build tag, call `RequireProduction()` at startup or set `SUPERDOG_REQUIRE_PRODUCTION=1`.  Ciphertexts written with a development key are marked and can be found with `IsDevCiphertext`.
+
 */
 package superdog
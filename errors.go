@@ -0,0 +1,77 @@
+package superdog
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrCiphertextTooShort is returned when a ciphertext is too short to hold its key version and IV.
+	ErrCiphertextTooShort = errors.New("Ciphertext too short")
+	// ErrAuthenticationFailed is returned when an authenticated ciphertext does not open: it was encrypted with
+	// another key, or has been tampered with.
+	ErrAuthenticationFailed = errors.New("Ciphertext authentication failed")
+	// ErrUnknownKeyVersion is returned when a provider has no key for a prefix and version.
+	ErrUnknownKeyVersion = errors.New("Unknown key version")
+	// ErrProviderUnavailable is returned when a provider could not reach its backend, or the backend could not
+	// serve the request. Retrying later may succeed.
+	ErrProviderUnavailable = errors.New("Provider unavailable")
+	// ErrUnsupportedCipher is returned for unknown ciphers and cipher block modes.
+	ErrUnsupportedCipher = errors.New("Unsupported cipher")
+)
+
+// Error is a failure of an operation on a key version of a prefix. Err is one of the errors above, and Cause the
+// underlying error, if any. errors.Is matches both.
+type Error struct {
+	Prefix  string // Empty if the failure is not tied to a prefix
+	Version uint64 // Zero if the key version is not known
+	Err     error
+	Cause   error
+}
+
+func (e *Error) Error() string {
+	s := e.Err.Error()
+	if e.Cause != nil {
+		s += ": " + e.Cause.Error()
+	}
+	switch {
+	case e.Prefix != "":
+		return fmt.Sprintf("Key %s version %d: %s", e.Prefix, e.Version, s)
+	case e.Version != 0:
+		return fmt.Sprintf("Key version %d: %s", e.Version, s)
+	}
+	return s
+}
+
+func (e *Error) Unwrap() []error {
+	if e.Cause == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Err, e.Cause}
+}
+
+// keyError returns err with the prefix and key version filled in if it is an *Error missing them, and
+// ErrUnknownKeyVersion, bare or wrapped, as an *Error.
+func keyError(prefix string, version uint64, err error) error {
+	if e, ok := err.(*Error); ok {
+		if (e.Prefix != "" || prefix == "") && (e.Version != 0 || version == 0) {
+			return e
+		}
+		c := *e
+		if c.Prefix == "" {
+			c.Prefix = prefix
+		}
+		if c.Version == 0 {
+			c.Version = version
+		}
+		return &c
+	}
+	if errors.Is(err, ErrUnknownKeyVersion) {
+		e := &Error{Prefix: prefix, Version: version, Err: ErrUnknownKeyVersion}
+		if err != ErrUnknownKeyVersion {
+			e.Cause = err
+		}
+		return e
+	}
+	return err
+}
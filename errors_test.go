@@ -0,0 +1,102 @@
+package superdog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// downKeys is a KeyProvider whose backend can not be reached.
+type downKeys struct{}
+
+func (downKeys) GetKey(prefix string, version uint64) (*Key, error) {
+	return nil, &Error{Err: ErrProviderUnavailable, Cause: io.ErrUnexpectedEOF}
+}
+
+func (downKeys) CurrentKeyVersion(prefix string) (uint64, error) {
+	return 0, &Error{Err: ErrProviderUnavailable, Cause: io.ErrUnexpectedEOF}
+}
+
+// wrappedNotFound is a KeyProvider wrapping ErrUnknownKeyVersion in its own error.
+type wrappedNotFound struct{}
+
+func (wrappedNotFound) GetKey(prefix string, version uint64) (*Key, error) {
+	return nil, fmt.Errorf("lookup: %w", ErrUnknownKeyVersion)
+}
+
+func (wrappedNotFound) CurrentKeyVersion(prefix string) (uint64, error) {
+	return 1, nil
+}
+
+func TestDecryptErrors(t *testing.T) {
+	defer func(kp KeyProvider) { DefaultKeyProvider = kp }(DefaultKeyProvider)
+
+	k, _ := NewKey(1, AES, GCM, make([]byte, 32))
+	DefaultKeyProvider = fixedKeys{1: k}
+
+	var e *Error
+	if _, err := Decrypt("ssn", nil, []byte("short")); !errors.Is(err, ErrCiphertextTooShort) || !errors.As(err, &e) || e.Prefix != "ssn" {
+		t.Fatal("Expected ciphertext too short error for ssn, got", err)
+	}
+
+	b, err := Encrypt("ssn", nil, []byte("Test Value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[len(b)-1] ^= 1
+	_, err = Decrypt("ssn", nil, append([]byte(nil), b...))
+	if !errors.Is(err, ErrAuthenticationFailed) || !errors.As(err, &e) || e.Prefix != "ssn" || e.Version != 1 || e.Cause == nil {
+		t.Fatal("Expected authentication failure of ssn version 1, got", err)
+	}
+	if ErrorType(err) != "authentication_failed" {
+		t.Fatal("Unexpected error type", ErrorType(err))
+	}
+
+	b, _ = EncryptWithVersion("ssn", 1, nil, []byte("Test Value"))
+	b[0] = 2
+	_, err = Decrypt("ssn", nil, b)
+	if !errors.Is(err, ErrUnknownKeyVersion) || !errors.Is(err, ErrKeyNotFound) || !errors.As(err, &e) || e.Prefix != "ssn" || e.Version != 2 {
+		t.Fatal("Expected unknown key version ssn 2, got", err)
+	}
+
+	b, _ = EncryptWithVersion("ssn", 1, nil, []byte("Test Value"))
+	b[0] = 0x80 // a varint continuing past the end of the ciphertext
+	for i := 1; i < len(b); i++ {
+		b[i] = 0x80
+	}
+	if got, err := Decrypt("ssn", nil, b); got != nil || !errors.Is(err, ErrCiphertextTooShort) || !errors.As(err, &e) || e.Prefix != "ssn" {
+		t.Fatal("Expected a malformed version to be a ciphertext too short error for ssn, got", err)
+	}
+
+	DefaultKeyProvider = wrappedNotFound{}
+	_, err = EncryptWithVersion("ssn", 4, nil, []byte("Test Value"))
+	if !errors.Is(err, ErrUnknownKeyVersion) || !errors.As(err, &e) || e.Prefix != "ssn" || e.Version != 4 {
+		t.Fatal("Expected a wrapped unknown key version to name ssn version 4, got", err)
+	}
+
+	DefaultKeyProvider = downKeys{}
+	_, err = Encrypt("ssn", nil, []byte("Test Value"))
+	if !errors.Is(err, ErrProviderUnavailable) || !errors.Is(err, io.ErrUnexpectedEOF) || !errors.As(err, &e) || e.Prefix != "ssn" {
+		t.Fatal("Expected provider unavailable for ssn, got", err)
+	}
+	if err.Error() != "Key ssn version 0: Provider unavailable: unexpected EOF" {
+		t.Fatal("Unexpected message", err)
+	}
+}
+
+func TestUnsupportedCipher(t *testing.T) {
+	var e *Error
+	if _, err := ParseCipher("DES"); !errors.Is(err, ErrUnsupportedCipher) {
+		t.Fatal("Expected unsupported cipher error, got", err)
+	}
+	if _, err := ParseCipherBlockMode("XTS"); !errors.Is(err, ErrUnsupportedCipher) {
+		t.Fatal("Expected unsupported cipher error, got", err)
+	}
+	if _, err := NewKey(3, Cipher(7), GCM, make([]byte, 32)); !errors.As(err, &e) || e.Err != ErrUnsupportedCipher || e.Version != 3 {
+		t.Fatal("Expected unsupported cipher error for version 3, got", err)
+	}
+	if _, err := NewKey(3, AES, CipherBlockMode(9), make([]byte, 32)); !errors.Is(err, ErrUnsupportedCipher) {
+		t.Fatal("Expected unsupported block mode error, got", err)
+	}
+}
@@ -0,0 +1,9 @@
+/*
+See LICENSE file for license details
+Copyright (c) 2015 XOR Data Exchange, Inc.
+
+
+Package flight collapses concurrent requests for the same key into one, so providers calling a remote service make a
+single request for a key version however many callers miss their cache at once.
+*/
+package flight
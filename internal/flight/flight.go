@@ -0,0 +1,47 @@
+package flight
+
+import (
+	"sync"
+)
+
+// flight is a request in progress, shared by every caller that asked for the same key while it was running.
+type flight struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// Group collapses concurrent requests for the same key into one. The zero Group is ready to use.
+type Group struct {
+	l       sync.Mutex
+	flights map[string]*flight
+}
+
+// Do runs fn and returns its result, unless a call for key is already running, in which case it waits for that call and
+// returns its result instead.
+func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	g.l.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	if f, ok := g.flights[key]; ok {
+		g.l.Unlock()
+		f.wg.Wait()
+		return f.val, f.err
+	}
+
+	f := new(flight)
+	f.wg.Add(1)
+	g.flights[key] = f
+	g.l.Unlock()
+
+	defer func() {
+		g.l.Lock()
+		delete(g.flights, key)
+		g.l.Unlock()
+		f.wg.Done()
+	}()
+
+	f.val, f.err = fn()
+	return f.val, f.err
+}
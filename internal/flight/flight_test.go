@@ -0,0 +1,41 @@
+package flight
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroupSharesCalls(t *testing.T) {
+	var g Group
+	var calls int32
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := g.Do("ssn/1", func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(20 * time.Millisecond)
+				return "key", nil
+			})
+			if err != nil || v != "key" {
+				t.Error("Expected the shared result", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Fatal("Expected concurrent calls to share one, got", n)
+	}
+	g.Do("ssn/1", func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, nil
+	})
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatal("Expected a later call to run again, got", n)
+	}
+}
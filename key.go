@@ -6,7 +6,11 @@ import (
 	"crypto/rand"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"runtime"
+	"sync"
+	"time"
 )
 
 type CipherBlockMode uint8
@@ -23,24 +27,111 @@ const (
 	AES Cipher = iota
 )
 
+var cipherNames = map[Cipher]string{
+	AES: "AES",
+}
+
+var blockModeNames = map[CipherBlockMode]string{
+	CFB: "CFB",
+	CTR: "CTR",
+	OFB: "OFB",
+	GCM: "GCM",
+}
+
+func (c Cipher) String() string {
+	if n, ok := cipherNames[c]; ok {
+		return n
+	}
+	return fmt.Sprintf("Cipher(%d)", uint8(c))
+}
+
+func (bm CipherBlockMode) String() string {
+	if n, ok := blockModeNames[bm]; ok {
+		return n
+	}
+	return fmt.Sprintf("CipherBlockMode(%d)", uint8(bm))
+}
+
+// ParseCipher returns the Cipher with the given name, e.g. "AES".
+func ParseCipher(s string) (Cipher, error) {
+	for c, n := range cipherNames {
+		if n == s {
+			return c, nil
+		}
+	}
+	return 0, &Error{Err: ErrUnsupportedCipher, Cause: fmt.Errorf("cipher %q", s)}
+}
+
+// ParseCipherBlockMode returns the CipherBlockMode with the given name, e.g. "GCM".
+func ParseCipherBlockMode(s string) (CipherBlockMode, error) {
+	for bm, n := range blockModeNames {
+		if n == s {
+			return bm, nil
+		}
+	}
+	return 0, &Error{Err: ErrUnsupportedCipher, Cause: fmt.Errorf("block mode %q", s)}
+}
+
+// ErrKeyDestroyed is returned when a key is used after Destroy.
+var ErrKeyDestroyed = errors.New("Key has been destroyed")
+
 type Key struct {
 	Cipher          Cipher
 	CipherBlockMode CipherBlockMode
+	l               sync.RWMutex
+	destroyed       bool
 	block           cipher.Block
 	ivlen           int
+	key             []byte
+	alloc           Allocator
+	bits            int
+	sealer          Sealer
+	dev             bool
 	Version         uint64
+
+	// Lifecycle metadata, as far as the provider records it. Zero times are unknown or unrestricted.
+	Created   time.Time // When the key was created
+	NotBefore time.Time // The key may not encrypt before this time
+	ExpiresAt time.Time // The key may not encrypt after this time
+	State     KeyState
+}
+
+// Sealer performs GCM encryption with a key held outside the process, such as in an HSM.
+// Seal may overwrite nonce with the nonce the device actually used.
+// Open returns an error wrapping ErrAuthenticationFailed if the ciphertext does not authenticate.
+type Sealer interface {
+	Seal(nonce, plaintext []byte) ([]byte, error)
+	Open(nonce, ciphertext []byte) ([]byte, error)
 }
 
 func NewKey(version uint64, c Cipher, bm CipherBlockMode, key []byte) (*Key, error) {
+	if _, ok := cipherNames[c]; !ok {
+		return nil, &Error{Version: version, Err: ErrUnsupportedCipher, Cause: fmt.Errorf("cipher %s", c)}
+	}
+	if _, ok := blockModeNames[bm]; !ok {
+		return nil, &Error{Version: version, Err: ErrUnsupportedCipher, Cause: fmt.Errorf("block mode %s", bm)}
+	}
+
 	k := &Key{
 		Cipher:          c,
 		CipherBlockMode: bm,
 		Version:         version,
+		bits:            len(key) * 8,
+	}
+
+	alloc := KeyAllocator
+	b, err := alloc.Alloc(len(key))
+	if err != nil {
+		return nil, err
+	}
+	copy(b, key)
+	k.key, k.alloc = b, alloc
+	if _, heap := alloc.(heapAllocator); !heap {
+		runtime.SetFinalizer(k, (*Key).Destroy)
 	}
 
 	switch c {
 	case AES:
-		var err error
 		k.block, err = aes.NewCipher(key)
 		if err != nil {
 			return k, err
@@ -55,13 +146,107 @@ func NewKey(version uint64, c Cipher, bm CipherBlockMode, key []byte) (*Key, err
 	return k, nil
 }
 
+// devMarker is written to the last byte of the version header of ciphertexts encrypted with a development key.
+// Versions below 2^49 never reach that byte, and decryption ignores it.
+const devMarker = 0xde
+
+// NewDevKey returns a key for development providers. Its ciphertexts are marked so IsDevCiphertext can detect them,
+// and it can not encrypt once RequireProduction has been called.
+func NewDevKey(version uint64, c Cipher, bm CipherBlockMode, key []byte) (*Key, error) {
+	k, err := NewKey(version, c, bm, key)
+	if k != nil {
+		k.dev = true
+	}
+	return k, err
+}
+
+// Dev reports whether the key was returned by a development provider.
+func (k *Key) Dev() bool {
+	return k.dev
+}
+
+// IsDevCiphertext reports whether b was encrypted with a development key.
+func IsDevCiphertext(b []byte) bool {
+	return len(b) > 8 && b[7] == devMarker
+}
+
+// NewExternalKey returns a GCM key of the given size in bits whose encryption is performed by s, so the raw key never
+// reaches this process. Bytes returns nil for such keys.
+func NewExternalKey(version uint64, c Cipher, bits int, s Sealer) *Key {
+	return &Key{
+		Cipher:          c,
+		CipherBlockMode: GCM,
+		Version:         version,
+		bits:            bits,
+		sealer:          s,
+		ivlen:           12,
+	}
+}
+
+// Bits returns the size of the key in bits.
+func (k *Key) Bits() int {
+	return k.bits
+}
+
+// Authenticated reports whether the key's block mode detects tampering with ciphertexts.
+func (k *Key) Authenticated() bool {
+	return k.CipherBlockMode == GCM
+}
+
+// Bytes returns a copy of the raw key. It is meant for providers that need to persist or wrap keys, and should not otherwise be used.
+func (k *Key) Bytes() []byte {
+	k.l.RLock()
+	defer k.l.RUnlock()
+	return append([]byte(nil), k.key...)
+}
+
+// Destroy wipes the key bytes and returns them to KeyAllocator. Any further use of the key returns ErrKeyDestroyed.
+// The expanded key schedule inside the cipher.Block is not reachable; it is dropped and left to the garbage collector.
+func (k *Key) Destroy() {
+	k.l.Lock()
+	defer k.l.Unlock()
+
+	if k.destroyed {
+		return
+	}
+	k.destroyed = true
+	if k.key != nil {
+		Wipe(k.key)
+		k.alloc.Free(k.key)
+	}
+	k.key = nil
+	k.block = nil
+	k.sealer = nil
+}
+
 func (k *Key) Encrypt(dst, src []byte) ([]byte, error) {
+	k.l.RLock()
+	defer k.l.RUnlock()
+	if k.destroyed {
+		return src, ErrKeyDestroyed
+	}
+	if err := k.CanEncrypt(time.Now()); err != nil {
+		return src, err
+	}
+
 	if len(dst) != len(src)+8+k.ivlen {
 		dst = make([]byte, len(src)+8+k.ivlen)
 	}
 
+	if k.dev {
+		if err := checkDev(); err != nil {
+			return src, err
+		}
+	}
+
 	// Place encryption KeyID at the beginning of cipher text
+	for i := range dst[:8] {
+		dst[i] = 0
+	}
 	binary.PutUvarint(dst[:8], k.Version)
+	if k.dev {
+		dst[7] = devMarker
+	}
 
 	// Followed by the IV
 	iv := dst[8 : k.ivlen+8]
@@ -80,6 +265,14 @@ func (k *Key) Encrypt(dst, src []byte) ([]byte, error) {
 		stream := cipher.NewOFB(k.block, iv)
 		stream.XORKeyStream(dst[8+k.ivlen:], src)
 	case GCM:
+		if k.sealer != nil {
+			b, err := k.sealer.Seal(iv, src)
+			if err != nil {
+				return src, err
+			}
+			return append(dst[:8+k.ivlen], b...), nil
+		}
+
 		aead, err := cipher.NewGCM(k.block)
 		if err != nil {
 			return dst, err
@@ -96,8 +289,17 @@ func (k *Key) Decrypt(dst, src []byte) ([]byte, error) {
 		return []byte{}, nil
 	}
 
-	if len(src) < k.block.BlockSize() {
-		return nil, errors.New("Insufficient length")
+	k.l.RLock()
+	defer k.l.RUnlock()
+	if k.destroyed {
+		return nil, ErrKeyDestroyed
+	}
+	if err := k.CanDecrypt(); err != nil {
+		return nil, err
+	}
+
+	if len(src) < k.ivlen || k.block != nil && len(src) < k.block.BlockSize() {
+		return nil, &Error{Version: k.Version, Err: ErrCiphertextTooShort}
 	}
 
 	iv := src[:k.ivlen]
@@ -117,11 +319,20 @@ func (k *Key) Decrypt(dst, src []byte) ([]byte, error) {
 		dst = dst[:len(text)]
 		stream.XORKeyStream(dst, text)
 	case GCM:
+		if k.sealer != nil {
+			b, err := k.sealer.Open(iv, text)
+			return b, keyError("", k.Version, err)
+		}
+
 		aead, err := cipher.NewGCM(k.block)
 		if err != nil {
 			return dst, err
 		}
-		return aead.Open(dst[:0], iv, text, nil)
+		b, err := aead.Open(dst[:0], iv, text, nil)
+		if err != nil {
+			return nil, &Error{Version: k.Version, Err: ErrAuthenticationFailed, Cause: err}
+		}
+		return b, nil
 	}
 	return dst, nil
 }
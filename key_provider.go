@@ -1,16 +1,22 @@
 package superdog
 
 import (
-	"errors"
-	"log"
+	"crypto/hmac"
+	"crypto/sha256"
 	"strconv"
+	"sync"
 )
 
+// ErrKeyNotFound is ErrUnknownKeyVersion, which providers return when they have no key for a prefix and version.
+var ErrKeyNotFound = ErrUnknownKeyVersion
+
 var (
-	ErrKeyNotFound = errors.New("Key not found")
+	_ KeyProvider = &DevKeyProvider{}
+	_ KeyProvider = &DevDerivedKeyProvider{}
 )
 
-var _ KeyProvider = &DevKeyProvider{}
+// DefaultDevSeed is the seed DevDerivedKeyProvider derives keys from when none is set.
+var DefaultDevSeed = []byte("SUPERDOG DEV SEED")
 
 // KeyProvider is an interface that wraps the GetKey method, responsible for retrieving encryption keys at a specified version.
 type KeyProvider interface {
@@ -18,25 +24,89 @@ type KeyProvider interface {
 	CurrentKeyVersion(prefix string) (uint64, error)
 }
 
-// DevKeyProvider is a KeyProvider used for development purposes only, and contains a hardcoded key.
+// DevKeyProvider is a KeyProvider used for development purposes only, and contains a hardcoded key. Versions from 10
+// on are derived from DefaultDevSeed, as by DevDerivedKeyProvider.
 type DevKeyProvider struct {
-	DisableWarn bool // Disable log messages whenever this provider is used.
+	DisableWarn bool // Disable the warning logged the first time this provider is used.
 	KeyVersion  uint64
+
+	warned sync.Once
 }
 
 // CurrentKeyVersion returns the version number of the latest key for a given prefix
 func (kp *DevKeyProvider) CurrentKeyVersion(prefix string) (uint64, error) {
+	if err := checkDev(); err != nil {
+		return 0, err
+	}
 	return kp.KeyVersion, nil
 }
 
 func (kp *DevKeyProvider) GetKey(prefix string, version uint64) (*Key, error) {
+	if err := checkDev(); err != nil {
+		return nil, err
+	}
+	if !kp.DisableWarn {
+		WarnDev(&kp.warned, "DevKeyProvider")
+	}
+
+	switch {
+	case version == 1:
+		return NewDevKey(version, AES, CFB, []byte("DEFAULT XOR KEY DEFAULT XOR KEY "))
+	case version < 10:
+		v := strconv.FormatUint(version, 10)
+		return NewDevKey(version, AES, GCM, []byte("DEFAULT XOR KEY DEFAULT XOR KEY"+v))
+	}
+	// the hardcoded key only has room for one digit, so later versions are derived as by DevDerivedKeyProvider
+	return NewDevKey(version, AES, GCM, deriveDevKey(DefaultDevSeed, prefix, version))
+}
+
+// DevDerivedKeyProvider is a KeyProvider used for development and tests only. It derives a distinct 256 bit key
+// for every prefix and version from Seed, so any version can be requested and keys can be rotated by bumping
+// KeyVersion. Anyone with the seed has every key; do not use it in production.
+type DevDerivedKeyProvider struct {
+	DisableWarn bool   // Disable the warning logged the first time this provider is used.
+	Seed        []byte // Seed the keys are derived from, DefaultDevSeed if empty
+	KeyVersion  uint64 // Version returned by CurrentKeyVersion
+
+	// Modes sets the block mode of individual versions, e.g. to test reencrypting CFB data. Other versions use GCM.
+	Modes map[uint64]CipherBlockMode
+
+	warned sync.Once
+}
+
+// CurrentKeyVersion returns KeyVersion for every prefix.
+func (kp *DevDerivedKeyProvider) CurrentKeyVersion(prefix string) (uint64, error) {
+	if err := checkDev(); err != nil {
+		return 0, err
+	}
+	return kp.KeyVersion, nil
+}
+
+// GetKey returns the key derived for prefix and version.
+func (kp *DevDerivedKeyProvider) GetKey(prefix string, version uint64) (*Key, error) {
+	if err := checkDev(); err != nil {
+		return nil, err
+	}
 	if !kp.DisableWarn {
-		log.Println("USING DEV KEY PROVIDER!")
+		WarnDev(&kp.warned, "DevDerivedKeyProvider")
 	}
 
-	if version == 1 {
-		return NewKey(version, AES, CFB, []byte("DEFAULT XOR KEY DEFAULT XOR KEY "))
+	seed := kp.Seed
+	if len(seed) == 0 {
+		seed = DefaultDevSeed
+	}
+	bm, ok := kp.Modes[version]
+	if !ok {
+		bm = GCM
 	}
-	v := strconv.FormatUint(version, 10)
-	return NewKey(version, AES, GCM, []byte("DEFAULT XOR KEY DEFAULT XOR KEY"+v))
+	return NewDevKey(version, AES, bm, deriveDevKey(seed, prefix, version))
+}
+
+// deriveDevKey returns the 256 bit development key of prefix and version derived from seed.
+func deriveDevKey(seed []byte, prefix string, version uint64) []byte {
+	mac := hmac.New(sha256.New, seed)
+	mac.Write([]byte(prefix))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strconv.FormatUint(version, 10)))
+	return mac.Sum(nil)
 }
@@ -0,0 +1,84 @@
+package superdog
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDevKeyProviderLaterVersions(t *testing.T) {
+	defer func(kp KeyProvider) { DefaultKeyProvider = kp }(DefaultKeyProvider)
+	kp := new(DevKeyProvider)
+	kp.DisableWarn = true
+	DefaultKeyProvider = kp
+
+	for _, version := range []uint64{9, 10, 12, 100} {
+		kp.KeyVersion = version
+		b, err := Encrypt("ssn", nil, []byte("123-45-6789"))
+		if err != nil {
+			t.Fatal("Expected version", version, "to encrypt", err)
+		}
+		plain, err := Decrypt("ssn", nil, b)
+		if err != nil || string(plain) != "123-45-6789" {
+			t.Fatal("Expected version", version, "to decrypt", err)
+		}
+		k, _ := kp.GetKey("ssn", version)
+		if k.Bits() != 256 {
+			t.Fatal("Expected a 256 bit key for version", version)
+		}
+	}
+}
+
+func TestDevDerivedKeyProvider(t *testing.T) {
+	kp := &DevDerivedKeyProvider{DisableWarn: true, KeyVersion: 12, Modes: map[uint64]CipherBlockMode{1: CFB}}
+
+	k1, err := kp.GetKey("ssn", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k1.CipherBlockMode != CFB || k1.Bits() != 256 || !k1.Dev() {
+		t.Fatal("Expected a 256 bit CFB dev key for version 1")
+	}
+
+	k12, err := kp.GetKey("ssn", 12)
+	if err != nil {
+		t.Fatal("Expected versions above 9 to be valid", err)
+	}
+	if k12.CipherBlockMode != GCM {
+		t.Fatal("Expected GCM by default")
+	}
+
+	other, _ := kp.GetKey("dob", 12)
+	if bytes.Equal(k12.Bytes(), other.Bytes()) {
+		t.Fatal("Expected a different key per prefix")
+	}
+	again, _ := kp.GetKey("ssn", 12)
+	if !bytes.Equal(k12.Bytes(), again.Bytes()) {
+		t.Fatal("Expected keys to be stable")
+	}
+
+	seeded, _ := (&DevDerivedKeyProvider{DisableWarn: true, Seed: []byte("test seed")}).GetKey("ssn", 12)
+	if bytes.Equal(k12.Bytes(), seeded.Bytes()) {
+		t.Fatal("Expected a different key per seed")
+	}
+}
+
+func TestDevDerivedKeyProviderRotation(t *testing.T) {
+	defer func(kp KeyProvider) { DefaultKeyProvider = kp }(DefaultKeyProvider)
+	kp := &DevDerivedKeyProvider{DisableWarn: true, KeyVersion: 1, Modes: map[uint64]CipherBlockMode{1: CFB}}
+	DefaultKeyProvider = kp
+
+	b, err := Encrypt("ssn", nil, []byte("123-45-6789"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kp.KeyVersion = 2
+	b, err = Reencrypt("ssn", b, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := Decrypt("ssn", b, b)
+	if err != nil || string(plain) != "123-45-6789" {
+		t.Fatal("Expected reencrypted value to decrypt", err)
+	}
+}
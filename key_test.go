@@ -3,6 +3,7 @@ package superdog
 import (
 	"bytes"
 	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
 	"io"
 	"testing"
@@ -74,6 +75,63 @@ func TestKeyDecrypt(t *testing.T) {
 	}
 }
 
+func TestParseCipherBlockMode(t *testing.T) {
+	for _, bm := range []CipherBlockMode{CFB, CTR, OFB, GCM} {
+		parsed, err := ParseCipherBlockMode(bm.String())
+		if err != nil || parsed != bm {
+			t.Fatal("Expected block mode to round trip", bm, err)
+		}
+	}
+
+	if c, err := ParseCipher("AES"); err != nil || c != AES {
+		t.Fatal("Expected AES cipher", err)
+	}
+	if _, err := ParseCipher("DES"); err == nil {
+		t.Fatal("Expected unsupported cipher error")
+	}
+}
+
+// softSealer performs GCM in process, standing in for a device.
+type softSealer struct {
+	aead cipher.AEAD
+}
+
+func (s softSealer) Seal(nonce, plaintext []byte) ([]byte, error) {
+	return s.aead.Seal(nil, nonce, plaintext, nil), nil
+}
+
+func (s softSealer) Open(nonce, ciphertext []byte) ([]byte, error) {
+	return s.aead.Open(nil, nonce, ciphertext, nil)
+}
+
+func TestExternalKey(t *testing.T) {
+	raw := []byte("Default Key XOR ")
+	block, _ := aes.NewCipher(raw)
+	aead, _ := cipher.NewGCM(block)
+	k := NewExternalKey(1, AES, 128, softSealer{aead})
+
+	b, err := k.Encrypt(nil, []byte("Test Value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Bytes() != nil {
+		t.Fatal("Expected external key not to expose key bytes")
+	}
+
+	// ciphertexts are interchangeable with an in-process key
+	k2, _ := NewKey(1, AES, GCM, raw)
+	decrypted, err := k2.Decrypt(nil, b[8:])
+	if err != nil || string(decrypted) != "Test Value" {
+		t.Fatal("Expected in-process key to decrypt", err)
+	}
+
+	b, _ = k2.Encrypt(nil, []byte("Test Value"))
+	decrypted, err = k.Decrypt(nil, b[8:])
+	if err != nil || string(decrypted) != "Test Value" {
+		t.Fatal("Expected external key to decrypt", err)
+	}
+}
+
 func BenchmarkKeyEncryptCFB(b *testing.B) {
 	val := []byte("Test Value")
 
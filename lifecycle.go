@@ -0,0 +1,88 @@
+package superdog
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// KeyState is the lifecycle state of a key version.
+type KeyState uint8
+
+const (
+	Active      KeyState = iota // The key encrypts and decrypts
+	DecryptOnly                 // The key only decrypts existing data, e.g. after it has been rotated out
+	Revoked                     // The key is compromised and must not be used at all
+)
+
+var keyStateNames = map[KeyState]string{
+	Active:      "active",
+	DecryptOnly: "decrypt-only",
+	Revoked:     "revoked",
+}
+
+func (s KeyState) String() string {
+	if n, ok := keyStateNames[s]; ok {
+		return n
+	}
+	return fmt.Sprintf("KeyState(%d)", uint8(s))
+}
+
+// ParseKeyState returns the KeyState with the given name, e.g. "decrypt-only". An empty name is Active.
+func ParseKeyState(s string) (KeyState, error) {
+	if s == "" {
+		return Active, nil
+	}
+	for st, n := range keyStateNames {
+		if n == s {
+			return st, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown key state %s", s)
+}
+
+var (
+	// ErrKeyNotActive is wrapped by a KeyStateError when a key that is decrypt-only, not yet valid or expired is used
+	// to encrypt.
+	ErrKeyNotActive = errors.New("Key is not active for encryption")
+	// ErrKeyRevoked is wrapped by a KeyStateError when a revoked key is used.
+	ErrKeyRevoked = errors.New("Key has been revoked")
+)
+
+// KeyStateError is returned when a key is used in a way its lifecycle does not allow.
+// Use errors.Is with ErrKeyNotActive or ErrKeyRevoked to tell the cases apart.
+type KeyStateError struct {
+	Version uint64
+	State   KeyState
+	Err     error
+}
+
+func (e *KeyStateError) Error() string {
+	return fmt.Sprintf("Key version %d (%s): %v", e.Version, e.State, e.Err)
+}
+
+func (e *KeyStateError) Unwrap() error {
+	return e.Err
+}
+
+// CanEncrypt returns a *KeyStateError unless k is active at time t: its state is Active, t is not before NotBefore
+// and not after ExpiresAt. Zero times are not checked.
+func (k *Key) CanEncrypt(t time.Time) error {
+	switch {
+	case k.State == Revoked:
+		return &KeyStateError{k.Version, k.State, ErrKeyRevoked}
+	case k.State != Active,
+		!k.NotBefore.IsZero() && t.Before(k.NotBefore),
+		!k.ExpiresAt.IsZero() && t.After(k.ExpiresAt):
+		return &KeyStateError{k.Version, k.State, ErrKeyNotActive}
+	}
+	return nil
+}
+
+// CanDecrypt returns a *KeyStateError if k has been revoked.
+func (k *Key) CanDecrypt() error {
+	if k.State == Revoked {
+		return &KeyStateError{k.Version, k.State, ErrKeyRevoked}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package superdog
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestKeyLifecycle(t *testing.T) {
+	k, _ := NewKey(3, AES, GCM, make([]byte, 32))
+	b, err := k.Encrypt(nil, []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k.State = DecryptOnly
+	_, err = k.Encrypt(nil, []byte("value"))
+	if !errors.Is(err, ErrKeyNotActive) {
+		t.Fatal("Expected not active error, got", err)
+	}
+	if _, err := k.Decrypt(nil, append([]byte(nil), b[8:]...)); err != nil {
+		t.Fatal("Expected decrypt-only key to decrypt", err)
+	}
+
+	k.State = Revoked
+	_, err = k.Decrypt(nil, b[8:])
+	var stateErr *KeyStateError
+	if !errors.As(err, &stateErr) || stateErr.Version != 3 || !errors.Is(err, ErrKeyRevoked) {
+		t.Fatal("Expected revoked key error, got", err)
+	}
+
+	k.State = Active
+	k.NotBefore = time.Now().Add(time.Hour)
+	if _, err := k.Encrypt(nil, []byte("value")); !errors.Is(err, ErrKeyNotActive) {
+		t.Fatal("Expected key not to encrypt before NotBefore, got", err)
+	}
+	k.NotBefore = time.Time{}
+	k.ExpiresAt = time.Now().Add(-time.Hour)
+	if _, err := k.Encrypt(nil, []byte("value")); !errors.Is(err, ErrKeyNotActive) {
+		t.Fatal("Expected key not to encrypt after ExpiresAt, got", err)
+	}
+}
+
+func TestParseKeyState(t *testing.T) {
+	for _, s := range []KeyState{Active, DecryptOnly, Revoked} {
+		if parsed, err := ParseKeyState(s.String()); err != nil || parsed != s {
+			t.Fatal("Expected state to round trip", s, err)
+		}
+	}
+	if s, err := ParseKeyState(""); err != nil || s != Active {
+		t.Fatal("Expected missing state to be active")
+	}
+	if _, err := ParseKeyState("compromised"); err == nil {
+		t.Fatal("Expected unknown state error")
+	}
+}
@@ -0,0 +1,35 @@
+package superdog
+
+import (
+	"log/slog"
+	"sync"
+)
+
+// Log attribute keys used by superdog and its providers, besides the span attribute keys such as AttrPrefix.
+const (
+	AttrProvider = "superdog.provider"
+	AttrError    = "error"
+)
+
+// DefaultLogger receives the log messages of superdog and its providers. Nil uses slog.Default().
+var DefaultLogger *slog.Logger
+
+// LoggerOrDefault returns l, or DefaultLogger if l is nil, or slog.Default() if both are. Providers with a Logger
+// field use it to pick the logger to write to.
+func LoggerOrDefault(l *slog.Logger) *slog.Logger {
+	if l != nil {
+		return l
+	}
+	if DefaultLogger != nil {
+		return DefaultLogger
+	}
+	return slog.Default()
+}
+
+// WarnDev logs, the first time it is called with once, that the development provider named provider is in use.
+func WarnDev(once *sync.Once, provider string) {
+	once.Do(func() {
+		LoggerOrDefault(nil).Warn("Using a development provider with well-known keys, do not use it in production",
+			AttrProvider, provider)
+	})
+}
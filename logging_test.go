@@ -0,0 +1,52 @@
+package superdog
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestDevProviderWarnsOnce(t *testing.T) {
+	defer func(l *slog.Logger) { DefaultLogger = l }(DefaultLogger)
+	var buf bytes.Buffer
+	DefaultLogger = slog.New(slog.NewTextHandler(&buf, nil))
+
+	kp := &DevKeyProvider{}
+	sp := &DevSaltProvider{}
+	for i := 0; i < 3; i++ {
+		kp.GetKey("ssn", 2)
+		sp.GetSalt("ssn", 1)
+	}
+	(&DevKeyProvider{DisableWarn: true}).GetKey("ssn", 2)
+
+	out := buf.String()
+	if n := strings.Count(out, "level=WARN"); n != 2 {
+		t.Fatal("Expected one warning per provider, got", out)
+	}
+	if !strings.Contains(out, AttrProvider+"=DevKeyProvider") || !strings.Contains(out, AttrProvider+"=DevSaltProvider") {
+		t.Fatal("Expected warnings to name the provider", out)
+	}
+
+	(&DevKeyProvider{}).GetKey("ssn", 2)
+	if n := strings.Count(buf.String(), "level=WARN"); n != 3 {
+		t.Fatal("Expected a new provider to warn again")
+	}
+}
+
+func TestLoggerOrDefault(t *testing.T) {
+	defer func(l *slog.Logger) { DefaultLogger = l }(DefaultLogger)
+	DefaultLogger = nil
+	if LoggerOrDefault(nil) != slog.Default() {
+		t.Fatal("Expected slog.Default")
+	}
+	l := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	DefaultLogger = l
+	if LoggerOrDefault(nil) != l {
+		t.Fatal("Expected DefaultLogger")
+	}
+	own := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	if LoggerOrDefault(own) != own {
+		t.Fatal("Expected the provider's own logger")
+	}
+}
@@ -0,0 +1,23 @@
+package superdog
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+// productionTag records whether production was required at startup, i.e. the tests were built with the production
+// tag, before TestMain allows the development providers again.
+var productionTag bool
+
+// TestMain discards log messages, such as the development provider warnings, so they do not flood the test output.
+// Tests of the log messages set DefaultLogger themselves. Most tests encrypt with the development providers, so they
+// are allowed even in the production build; TestRequireProduction and TestProductionTag check that they are refused.
+func TestMain(m *testing.M) {
+	DefaultLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	productionTag = ProductionRequired()
+	atomic.StoreInt32(&production, 0)
+	os.Exit(m.Run())
+}
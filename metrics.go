@@ -0,0 +1,100 @@
+package superdog
+
+import (
+	"errors"
+	"time"
+)
+
+// Operations reported to Metrics.
+const (
+	OpEncrypt   = "encrypt"
+	OpDecrypt   = "decrypt"
+	OpReencrypt = "reencrypt"
+	OpHash      = "hash"
+)
+
+// Metrics receives measurements from superdog and its providers. Implementations must be safe for concurrent use,
+// and should return quickly as they are called on every operation.
+type Metrics interface {
+	// Operation records an Encrypt, Decrypt, Reencrypt or Hash of prefix. version is the key or salt version used,
+	// and mode the key's block mode, or "" for hashes and keys that could not be fetched.
+	Operation(op, prefix string, version uint64, mode string, d time.Duration, err error)
+	// ProviderRequest records a request a provider made to its backend, such as a Vault read. provider names the
+	// provider, e.g. "hashi", and op the lookup, e.g. "GetKey".
+	ProviderRequest(provider, op, prefix string, d time.Duration, err error)
+	// CacheLookup records whether a provider answered a lookup from its cache.
+	CacheLookup(provider, op, prefix string, hit bool)
+}
+
+// NopMetrics discards all measurements.
+type NopMetrics struct{}
+
+var _ Metrics = NopMetrics{}
+
+func (NopMetrics) Operation(op, prefix string, version uint64, mode string, d time.Duration, err error) {
+}
+
+func (NopMetrics) ProviderRequest(provider, op, prefix string, d time.Duration, err error) {
+}
+
+func (NopMetrics) CacheLookup(provider, op, prefix string, hit bool) {
+}
+
+// DefaultMetrics receives the measurements of the package functions and the providers in vault.
+var DefaultMetrics Metrics = NopMetrics{}
+
+// ErrorType returns a short name for the kind of err, for labelling errors in metrics: "key_not_found",
+// "salt_not_found", "ciphertext_too_short", "authentication_failed", "provider_unavailable",
+// "unsupported_cipher", "policy", "key_state", "usage_limit", "key_destroyed", "dev_provider" or "other".
+// It returns "" for a nil error.
+func ErrorType(err error) string {
+	var (
+		policyErr *PolicyError
+		stateErr  *KeyStateError
+		usageErr  *UsageError
+	)
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrKeyNotFound):
+		return "key_not_found"
+	case errors.Is(err, ErrSaltNotFound):
+		return "salt_not_found"
+	case errors.Is(err, ErrCiphertextTooShort):
+		return "ciphertext_too_short"
+	case errors.Is(err, ErrAuthenticationFailed):
+		return "authentication_failed"
+	case errors.Is(err, ErrProviderUnavailable):
+		return "provider_unavailable"
+	case errors.Is(err, ErrUnsupportedCipher):
+		return "unsupported_cipher"
+	case errors.As(err, &policyErr):
+		return "policy"
+	case errors.As(err, &stateErr):
+		return "key_state"
+	case errors.As(err, &usageErr):
+		return "usage_limit"
+	case errors.Is(err, ErrKeyDestroyed):
+		return "key_destroyed"
+	case errors.Is(err, ErrDevProvider):
+		return "dev_provider"
+	}
+	return "other"
+}
+
+// finish ends the span of an operation that started at start, and reports it to DefaultMetrics. version is the key
+// or salt version used, and k the key if it was fetched.
+func finish(span Span, op, prefix string, version uint64, k *Key, start time.Time, err error) {
+	mode := ""
+	if k != nil {
+		mode = k.CipherBlockMode.String()
+		span.SetAttribute(AttrMode, mode)
+	}
+	if op == OpHash {
+		span.SetAttribute(AttrSaltVersion, version)
+	} else {
+		span.SetAttribute(AttrKeyVersion, version)
+	}
+	span.End(err)
+	DefaultMetrics.Operation(op, prefix, version, mode, time.Since(start), err)
+}
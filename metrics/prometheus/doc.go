@@ -0,0 +1,15 @@
+/*
+See LICENSE file for license details
+Copyright (c) 2015 XOR Data Exchange, Inc.
+
+
+Package prometheus exports superdog's metrics to Prometheus. Create a Metrics, register it and make it the default:
+
+	m := prometheus.New("myapp")
+	registry.MustRegister(m)
+	superdog.DefaultMetrics = m
+
+Operations are counted by prefix, key version and block mode, errors by superdog.ErrorType, and latencies and
+provider cache hits and misses are recorded by prefix.
+*/
+package prometheus
@@ -0,0 +1,88 @@
+package prometheus
+
+import (
+	"strconv"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/xordataexchange/superdog"
+)
+
+var (
+	_ superdog.Metrics = &Metrics{}
+	_ prom.Collector   = &Metrics{}
+)
+
+// Metrics is a superdog.Metrics and a prometheus.Collector.
+type Metrics struct {
+	operations      *prom.CounterVec
+	operationErrors *prom.CounterVec
+	operationTime   *prom.HistogramVec
+	requests        *prom.CounterVec
+	requestErrors   *prom.CounterVec
+	requestTime     *prom.HistogramVec
+	cache           *prom.CounterVec
+}
+
+// New returns Metrics whose metric names start with namespace, e.g. "myapp_superdog_operations_total".
+// An empty namespace leaves the names starting with "superdog_".
+func New(namespace string) *Metrics {
+	counter := func(name, help string, labels ...string) *prom.CounterVec {
+		return prom.NewCounterVec(prom.CounterOpts{Namespace: namespace, Subsystem: "superdog", Name: name, Help: help}, labels)
+	}
+	histogram := func(name, help string, labels ...string) *prom.HistogramVec {
+		return prom.NewHistogramVec(prom.HistogramOpts{Namespace: namespace, Subsystem: "superdog", Name: name, Help: help}, labels)
+	}
+
+	return &Metrics{
+		operations:      counter("operations_total", "Encrypt, decrypt, reencrypt and hash operations.", "op", "prefix", "version", "mode"),
+		operationErrors: counter("operation_errors_total", "Failed operations by error type.", "op", "prefix", "type"),
+		operationTime:   histogram("operation_duration_seconds", "Time taken by operations, including key lookups.", "op", "prefix"),
+		requests:        counter("provider_requests_total", "Requests made by providers to their backends.", "provider", "op", "prefix"),
+		requestErrors:   counter("provider_request_errors_total", "Failed provider requests by error type.", "provider", "op", "prefix", "type"),
+		requestTime:     histogram("provider_request_duration_seconds", "Time taken by provider requests.", "provider", "op", "prefix"),
+		cache:           counter("provider_cache_lookups_total", "Provider cache lookups by result, hit or miss.", "provider", "op", "prefix", "result"),
+	}
+}
+
+func (m *Metrics) Operation(op, prefix string, version uint64, mode string, d time.Duration, err error) {
+	m.operations.WithLabelValues(op, prefix, strconv.FormatUint(version, 10), mode).Inc()
+	m.operationTime.WithLabelValues(op, prefix).Observe(d.Seconds())
+	if err != nil {
+		m.operationErrors.WithLabelValues(op, prefix, superdog.ErrorType(err)).Inc()
+	}
+}
+
+func (m *Metrics) ProviderRequest(provider, op, prefix string, d time.Duration, err error) {
+	m.requests.WithLabelValues(provider, op, prefix).Inc()
+	m.requestTime.WithLabelValues(provider, op, prefix).Observe(d.Seconds())
+	if err != nil {
+		m.requestErrors.WithLabelValues(provider, op, prefix, superdog.ErrorType(err)).Inc()
+	}
+}
+
+func (m *Metrics) CacheLookup(provider, op, prefix string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	m.cache.WithLabelValues(provider, op, prefix, result).Inc()
+}
+
+func (m *Metrics) collectors() []prom.Collector {
+	return []prom.Collector{m.operations, m.operationErrors, m.operationTime, m.requests, m.requestErrors, m.requestTime, m.cache}
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prom.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prom.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
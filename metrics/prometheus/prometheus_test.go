@@ -0,0 +1,73 @@
+package prometheus
+
+import (
+	"testing"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/xordataexchange/superdog"
+	"github.com/xordataexchange/superdog/superdogtest"
+)
+
+// value returns the value of the counter name whose labels include labels, or -1 if there is none.
+func value(t *testing.T, r *prom.Registry, name string, labels map[string]string) float64 {
+	families, err := r.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range f.GetMetric() {
+			have := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				have[l.GetName()] = l.GetValue()
+			}
+			for k, v := range labels {
+				if have[k] != v {
+					continue metrics
+				}
+			}
+			return m.GetCounter().GetValue()
+		}
+	}
+	return -1
+}
+
+func TestMetrics(t *testing.T) {
+	defer func(m superdog.Metrics) { superdog.DefaultMetrics = m }(superdog.DefaultMetrics)
+	keys := superdogtest.NewMemoryProvider()
+	keys.Rotate("ssn")
+	keys.Rotate("ssn")
+	defer keys.Install()()
+
+	m := New("")
+	r := prom.NewRegistry()
+	r.MustRegister(m)
+	superdog.DefaultMetrics = m
+
+	b, err := superdog.Encrypt("ssn", nil, []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := superdog.Decrypt("ssn", nil, append([]byte(nil), b...)); err != nil {
+		t.Fatal(err)
+	}
+	b[len(b)-1] ^= 1
+	superdog.Decrypt("ssn", nil, b)
+	m.CacheLookup("hashi", "GetKey", "ssn", true)
+
+	if v := value(t, r, "superdog_operations_total", map[string]string{"op": "encrypt", "prefix": "ssn", "version": "2", "mode": "GCM"}); v != 1 {
+		t.Fatal("Expected one encryption to be counted, got", v)
+	}
+	if v := value(t, r, "superdog_operations_total", map[string]string{"op": "decrypt", "version": "2"}); v != 2 {
+		t.Fatal("Expected two decryptions to be counted, got", v)
+	}
+	if v := value(t, r, "superdog_operation_errors_total", map[string]string{"op": "decrypt", "type": "authentication_failed"}); v != 1 {
+		t.Fatal("Expected the failed decryption to be counted, got", v)
+	}
+	if v := value(t, r, "superdog_provider_cache_lookups_total", map[string]string{"provider": "hashi", "result": "hit"}); v != 1 {
+		t.Fatal("Expected the cache hit to be counted, got", v)
+	}
+}
@@ -0,0 +1,66 @@
+package superdog
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a Metrics keeping the operations it is told about.
+type recorder struct {
+	NopMetrics
+	l   sync.Mutex
+	ops []string
+}
+
+func (r *recorder) Operation(op, prefix string, version uint64, mode string, d time.Duration, err error) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	r.ops = append(r.ops, fmt.Sprintf("%s %s %d %s %s", op, prefix, version, mode, ErrorType(err)))
+}
+
+func TestMetricsOperations(t *testing.T) {
+	defer func(kp KeyProvider) { DefaultKeyProvider = kp }(DefaultKeyProvider)
+	defer func(sp SaltProvider) { DefaultSaltProvider = sp }(DefaultSaltProvider)
+	defer func(m Metrics) { DefaultMetrics = m }(DefaultMetrics)
+	k, _ := NewKey(1, AES, GCM, make([]byte, 32))
+	DefaultKeyProvider = fixedKeys{1: k}
+	DefaultSaltProvider = &DevSaltProvider{DisableWarn: true, SaltVersion: 1}
+	r := &recorder{}
+	DefaultMetrics = r
+
+	b, _ := Encrypt("ssn", nil, []byte("value"))
+	Reencrypt("ssn", nil, b)
+	Hash("ssn", []byte("value"))
+	EncryptWithVersion("ssn", 5, nil, []byte("value"))
+
+	expected := []string{
+		"encrypt ssn 1 GCM ",
+		"reencrypt ssn 1 GCM ",
+		"hash ssn 1  ",
+		"encrypt ssn 5  key_not_found",
+	}
+	if fmt.Sprint(r.ops) != fmt.Sprint(expected) {
+		t.Fatal("Unexpected operations recorded", r.ops)
+	}
+}
+
+func TestErrorType(t *testing.T) {
+	errs := map[error]string{
+		nil:            "",
+		ErrKeyNotFound: "key_not_found",
+		fmt.Errorf("lookup: %w", ErrSaltNotFound): "salt_not_found",
+		&PolicyError{}:                      "policy",
+		&KeyStateError{Err: ErrKeyRevoked}:  "key_state",
+		&UsageError{}:                       "usage_limit",
+		&Error{Err: ErrProviderUnavailable}: "provider_unavailable",
+		errors.New("boom"):                  "other",
+	}
+	for err, name := range errs {
+		if ErrorType(err) != name {
+			t.Fatal("Unexpected error type for", err, ErrorType(err))
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package superdog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Policy restricts the keys a prefix may be encrypted with. The zero Policy allows every key.
+type Policy struct {
+	Ciphers    []Cipher          // Ciphers allowed for new encryption; empty allows all
+	BlockModes []CipherBlockMode // Block modes allowed for new encryption; empty allows all
+	MinKeyBits int               // Minimum key size in bits for new encryption
+
+	// DecryptOnlyUnauthenticated stops keys in modes without authentication, CFB, CTR and OFB, from encrypting.
+	// They can still decrypt existing data so it can be reencrypted.
+	DecryptOnlyUnauthenticated bool
+
+	// MaxKeyAge stops keys created longer ago than this from encrypting. Keys whose provider does not record
+	// when they were created are not limited.
+	MaxKeyAge time.Duration
+}
+
+// PolicyError is returned when a key returned by the KeyProvider violates the policy of its prefix.
+type PolicyError struct {
+	Prefix  string
+	Version uint64
+	Reason  string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("Key %s version %d violates policy: %s", e.Prefix, e.Version, e.Reason)
+}
+
+var (
+	policyLock sync.RWMutex
+	policies   = make(map[string]Policy)
+)
+
+// DefaultPolicy applies to prefixes without a policy of their own.
+var DefaultPolicy Policy
+
+// SetPolicy assigns p to prefix.
+func SetPolicy(prefix string, p Policy) {
+	policyLock.Lock()
+	defer policyLock.Unlock()
+	policies[prefix] = p
+}
+
+// PolicyFor returns the policy assigned to prefix, or DefaultPolicy.
+func PolicyFor(prefix string) Policy {
+	policyLock.RLock()
+	defer policyLock.RUnlock()
+	if p, ok := policies[prefix]; ok {
+		return p
+	}
+	return DefaultPolicy
+}
+
+// CheckEncrypt returns a *PolicyError if k may not be used for new encryption under p.
+func (p Policy) CheckEncrypt(prefix string, k *Key) error {
+	if len(p.Ciphers) > 0 && !containsCipher(p.Ciphers, k.Cipher) {
+		return &PolicyError{prefix, k.Version, "cipher " + k.Cipher.String() + " is not allowed"}
+	}
+	if len(p.BlockModes) > 0 && !containsBlockMode(p.BlockModes, k.CipherBlockMode) {
+		return &PolicyError{prefix, k.Version, "block mode " + k.CipherBlockMode.String() + " is not allowed"}
+	}
+	if k.Bits() < p.MinKeyBits {
+		return &PolicyError{prefix, k.Version, fmt.Sprintf("%d bit key is shorter than %d bits", k.Bits(), p.MinKeyBits)}
+	}
+	if p.DecryptOnlyUnauthenticated && !k.Authenticated() {
+		return &PolicyError{prefix, k.Version, "block mode " + k.CipherBlockMode.String() + " may only decrypt"}
+	}
+	if p.MaxKeyAge > 0 && !k.Created.IsZero() && time.Since(k.Created) > p.MaxKeyAge {
+		return &PolicyError{prefix, k.Version, "key is older than " + p.MaxKeyAge.String()}
+	}
+	return nil
+}
+
+// CheckKey returns a *PolicyError if k is not a usable key for version. The package functions check every key returned
+// by the KeyProvider with it. The algorithm and size restrictions of p are left to CheckEncrypt, so existing data
+// written with a key p no longer allows can still be decrypted and reencrypted.
+func (p Policy) CheckKey(prefix string, version uint64, k *Key) error {
+	if k.Version != version {
+		return &PolicyError{prefix, version, fmt.Sprintf("provider returned version %d", k.Version)}
+	}
+	if _, ok := cipherNames[k.Cipher]; !ok {
+		return &PolicyError{prefix, version, "unsupported cipher " + k.Cipher.String()}
+	}
+	if _, ok := blockModeNames[k.CipherBlockMode]; !ok {
+		return &PolicyError{prefix, version, "unsupported block mode " + k.CipherBlockMode.String()}
+	}
+	if _, ok := keyStateNames[k.State]; !ok {
+		return &PolicyError{prefix, version, "unknown key state " + k.State.String()}
+	}
+	return nil
+}
+
+func containsCipher(cs []Cipher, c Cipher) bool {
+	for _, x := range cs {
+		if x == c {
+			return true
+		}
+	}
+	return false
+}
+
+func containsBlockMode(bms []CipherBlockMode, bm CipherBlockMode) bool {
+	for _, x := range bms {
+		if x == bm {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package superdog
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// fixedKeys is a KeyProvider returning the keys it holds, keyed by version.
+type fixedKeys map[uint64]*Key
+
+func (f fixedKeys) GetKey(prefix string, version uint64) (*Key, error) {
+	k, ok := f[version]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	return k, nil
+}
+
+func (f fixedKeys) CurrentKeyVersion(prefix string) (uint64, error) {
+	return uint64(len(f)), nil
+}
+
+func TestPolicyEncrypt(t *testing.T) {
+	defer func(kp KeyProvider) { DefaultKeyProvider = kp }(DefaultKeyProvider)
+	defer SetPolicy("ssn", Policy{})
+
+	short, _ := NewKey(1, AES, GCM, make([]byte, 16))
+	cfb, _ := NewKey(2, AES, CFB, make([]byte, 32))
+	old, _ := NewKey(3, AES, GCM, make([]byte, 32))
+	old.Created = time.Now().Add(-48 * time.Hour)
+	good, _ := NewKey(4, AES, GCM, make([]byte, 32))
+	good.Created = time.Now()
+	DefaultKeyProvider = fixedKeys{1: short, 2: cfb, 3: old, 4: good}
+
+	SetPolicy("ssn", Policy{
+		Ciphers:                    []Cipher{AES},
+		MinKeyBits:                 256,
+		DecryptOnlyUnauthenticated: true,
+		MaxKeyAge:                  24 * time.Hour,
+	})
+
+	for _, version := range []uint64{1, 2, 3} {
+		_, err := EncryptWithVersion("ssn", version, nil, []byte("123-45-6789"))
+		if _, ok := err.(*PolicyError); !ok {
+			t.Fatal("Expected policy error for version", version, err)
+		}
+	}
+
+	b, err := EncryptWithVersion("ssn", 4, nil, []byte("123-45-6789"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt("ssn", b, b); err != nil {
+		t.Fatal(err)
+	}
+
+	// unauthenticated keys can still decrypt, so data can be reencrypted
+	b, _ = cfb.Encrypt(nil, []byte("123-45-6789"))
+	b, err = Reencrypt("ssn", b, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := binary.Uvarint(b); v != 4 {
+		t.Fatal("Expected reencryption with the current key, got version", v)
+	}
+
+	// other prefixes are not restricted
+	if _, err := EncryptWithVersion("dob", 2, nil, []byte("1970-01-01")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPolicyCheckKey(t *testing.T) {
+	defer func(kp KeyProvider) { DefaultKeyProvider = kp }(DefaultKeyProvider)
+
+	k, _ := NewKey(2, AES, GCM, make([]byte, 32))
+	DefaultKeyProvider = fixedKeys{1: k}
+
+	b, _ := k.Encrypt(nil, []byte("value"))
+	b[0] = 1
+	if _, err := Decrypt("ssn", b, b); err == nil {
+		t.Fatal("Expected error for a key of the wrong version")
+	}
+
+	defer SetPolicy("ssn", Policy{})
+	SetPolicy("ssn", Policy{MinKeyBits: 256})
+	short, _ := NewKey(1, AES, GCM, make([]byte, 16))
+	long, _ := NewKey(2, AES, GCM, make([]byte, 32))
+	DefaultKeyProvider = fixedKeys{1: short, 2: long}
+	b, _ = short.Encrypt(nil, []byte("value"))
+
+	_, err := EncryptWithVersion("ssn", 1, nil, []byte("value"))
+	if e, ok := err.(*PolicyError); !ok || e.Version != 1 {
+		t.Fatal("Expected a key shorter than the policy allows to be refused for encryption, got", err)
+	}
+	if plain, err := Decrypt("ssn", nil, append([]byte(nil), b...)); err != nil || string(plain) != "value" {
+		t.Fatal("Expected data written with a short key to decrypt", err)
+	}
+	b, err = Reencrypt("ssn", nil, b)
+	if err != nil {
+		t.Fatal("Expected data written with a short key to reencrypt", err)
+	}
+	if v, _ := binary.Uvarint(b); v != 2 {
+		t.Fatal("Expected reencryption with the current key, got version", v)
+	}
+}
@@ -0,0 +1,49 @@
+package superdog
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"sync/atomic"
+)
+
+// ProductionEnv is the environment variable that, when set to a true value such as "1", has the same effect as
+// calling RequireProduction at startup.
+const ProductionEnv = "SUPERDOG_REQUIRE_PRODUCTION"
+
+// ErrDevProvider is returned by the development providers, and by Encrypt for development keys, once production
+// has been required.
+var ErrDevProvider = errors.New("Development key and salt providers are disabled in production")
+
+var production int32
+
+func init() {
+	if productionFromEnv() {
+		RequireProduction()
+	}
+}
+
+func productionFromEnv() bool {
+	ok, _ := strconv.ParseBool(os.Getenv(ProductionEnv))
+	return ok
+}
+
+// RequireProduction makes DevKeyProvider, DevSaltProvider, vault.DevVault and any other development key fail with
+// ErrDevProvider, so a missing provider configuration stops the program instead of silently using well-known keys.
+// It can not be undone. Building with the "production" tag calls it at startup.
+func RequireProduction() {
+	atomic.StoreInt32(&production, 1)
+}
+
+// ProductionRequired reports whether RequireProduction has been called.
+func ProductionRequired() bool {
+	return atomic.LoadInt32(&production) == 1
+}
+
+// checkDev returns ErrDevProvider if production has been required.
+func checkDev() error {
+	if ProductionRequired() {
+		return ErrDevProvider
+	}
+	return nil
+}
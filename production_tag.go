@@ -0,0 +1,8 @@
+//go:build production
+// +build production
+
+package superdog
+
+func init() {
+	RequireProduction()
+}
@@ -0,0 +1,24 @@
+//go:build production
+// +build production
+
+package superdog
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestProductionTag(t *testing.T) {
+	if !productionTag {
+		t.Fatal("Expected the production tag to require production")
+	}
+
+	defer atomic.StoreInt32(&production, 0)
+	RequireProduction()
+	if _, err := (&DevKeyProvider{DisableWarn: true}).GetKey("test", 1); err != ErrDevProvider {
+		t.Fatal("Expected dev provider error, got", err)
+	}
+	if _, err := (&DevSaltProvider{DisableWarn: true}).GetSalt("test", 1); err != ErrDevProvider {
+		t.Fatal("Expected dev provider error, got", err)
+	}
+}
@@ -0,0 +1,73 @@
+package superdog
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestRequireProduction(t *testing.T) {
+	defer atomic.StoreInt32(&production, 0)
+
+	kp := &DevKeyProvider{DisableWarn: true, KeyVersion: 2}
+	k, err := kp.GetKey("test", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	RequireProduction()
+
+	if _, err := kp.GetKey("test", 2); err != ErrDevProvider {
+		t.Fatal("Expected dev provider error, got", err)
+	}
+	if _, err := kp.CurrentKeyVersion("test"); err != ErrDevProvider {
+		t.Fatal("Expected dev provider error, got", err)
+	}
+	sp := &DevSaltProvider{DisableWarn: true}
+	if _, err := sp.GetSalt("test", 1); err != ErrDevProvider {
+		t.Fatal("Expected dev provider error, got", err)
+	}
+	if _, err := sp.CurrentSalts("test"); err != ErrDevProvider {
+		t.Fatal("Expected dev provider error, got", err)
+	}
+
+	// a dev key obtained before, or from another provider, can not encrypt either
+	if _, err := k.Encrypt(nil, []byte("value")); err != ErrDevProvider {
+		t.Fatal("Expected dev provider error, got", err)
+	}
+}
+
+func TestProductionFromEnv(t *testing.T) {
+	t.Setenv(ProductionEnv, "")
+	if productionFromEnv() {
+		t.Fatal("Expected production not to be required")
+	}
+	t.Setenv(ProductionEnv, "true")
+	if !productionFromEnv() {
+		t.Fatal("Expected production to be required")
+	}
+}
+
+func TestIsDevCiphertext(t *testing.T) {
+	dev, _ := NewDevKey(1, AES, GCM, make([]byte, 32))
+	b, err := dev.Encrypt(nil, []byte("value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsDevCiphertext(b) {
+		t.Fatal("Expected dev ciphertext to be marked")
+	}
+	plain, err := dev.Decrypt(nil, b[8:])
+	if err != nil || string(plain) != "value" {
+		t.Fatal("Expected marked ciphertext to decrypt", err)
+	}
+
+	k, _ := NewKey(1, AES, GCM, make([]byte, 32))
+	dst := make([]byte, len("value")+8+12)
+	for i := range dst {
+		dst[i] = devMarker
+	}
+	b, _ = k.Encrypt(dst, []byte("value"))
+	if IsDevCiphertext(b) {
+		t.Fatal("Expected ciphertext not to be marked")
+	}
+}
@@ -1,8 +1,13 @@
 package superdog
 
 import (
-	"log"
+	"errors"
 	"strconv"
+	"sync"
+)
+
+var (
+	ErrSaltNotFound = errors.New("Salt not found")
 )
 
 var _ SaltProvider = &DevSaltProvider{}
@@ -15,28 +20,39 @@ type SaltProvider interface {
 
 // DevSaltProvider is a KeyProvider used for development purposes only, and contains a hardcoded key.
 type DevSaltProvider struct {
-	DisableWarn bool // Disable log messages whenever this provider is used.
+	DisableWarn bool // Disable the warning logged the first time this provider is used.
 	SaltVersion uint64
+
+	warned sync.Once
 }
 
 // CurrentSaltVersion returns the version number of the latest salt for a given prefix
 func (sp *DevSaltProvider) CurrentSaltVersion(prefix string) (uint64, error) {
+	if err := checkDev(); err != nil {
+		return 0, err
+	}
 	return sp.SaltVersion, nil
 
 }
 
 // CurrentSalts returns a stubbed list of salts to be used for the given prefix
 func (sp *DevSaltProvider) CurrentSalts(prefix string) ([]uint64, error) {
+	if err := checkDev(); err != nil {
+		return nil, err
+	}
 	if !sp.DisableWarn {
-		log.Println("USING DEV SALT PROVIDER!")
+		WarnDev(&sp.warned, "DevSaltProvider")
 	}
 	return []uint64{1, 2, 3}, nil
 }
 
 // GetSalt returns a stubbed salt to be used for the given prefix
 func (sp *DevSaltProvider) GetSalt(prefix string, version uint64) ([]byte, error) {
+	if err := checkDev(); err != nil {
+		return nil, err
+	}
 	if !sp.DisableWarn {
-		log.Println("USING DEV SALT PROVIDER!")
+		WarnDev(&sp.warned, "DevSaltProvider")
 	}
 	return []byte("DEV SALT " + prefix + " " + strconv.FormatUint(version, 10)), nil
 }
@@ -0,0 +1,45 @@
+package superdogtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/xordataexchange/superdog"
+)
+
+// AssertEncryptedWith fails the test unless ct was encrypted with version of prefix's key from
+// superdog.DefaultKeyProvider. For GCM keys the ciphertext must also authenticate.
+func AssertEncryptedWith(t testing.TB, ct []byte, prefix string, version uint64) {
+	t.Helper()
+
+	if len(ct) <= 8 {
+		t.Fatalf("Ciphertext of %d bytes is too short", len(ct))
+	}
+	v, _ := binary.Uvarint(ct[:8])
+	if v != version {
+		t.Fatalf("Expected ciphertext encrypted with %s version %d, got version %d", prefix, version, v)
+	}
+
+	k, err := superdog.DefaultKeyProvider.GetKey(prefix, version)
+	if err != nil {
+		t.Fatalf("Failed to get %s version %d: %v", prefix, version, err)
+	}
+	if _, err := k.Decrypt(make([]byte, len(ct)-8), append([]byte(nil), ct[8:]...)); err != nil {
+		t.Fatalf("Ciphertext does not decrypt with %s version %d: %v", prefix, version, err)
+	}
+}
+
+// AssertDecryptsTo fails the test unless ct decrypts to plain with prefix's keys from superdog.DefaultKeyProvider.
+func AssertDecryptsTo(t testing.TB, ct []byte, prefix string, plain []byte) {
+	t.Helper()
+
+	b := append([]byte(nil), ct...)
+	got, err := superdog.Decrypt(prefix, b, b)
+	if err != nil {
+		t.Fatalf("Failed to decrypt with %s: %v", prefix, err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Fatalf("Expected ciphertext to decrypt to %q, got %q", plain, got)
+	}
+}
@@ -0,0 +1,10 @@
+/*
+See LICENSE file for license details
+Copyright (c) 2015 XOR Data Exchange, Inc.
+
+
+Package superdogtest provides an in-memory, programmable provider and assertion helpers for testing code that uses
+superdog. Keys and salts can be rotated mid-test, calls can be made to fail or to take time, and every call is
+recorded.
+*/
+package superdogtest
@@ -0,0 +1,330 @@
+package superdogtest
+
+import (
+	"crypto/rand"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/xordataexchange/superdog"
+	"github.com/xordataexchange/superdog/vault"
+)
+
+// Names of the provider methods, for SetError and Call.
+const (
+	GetKey             = "GetKey"
+	CurrentKeyVersion  = "CurrentKeyVersion"
+	GetSalt            = "GetSalt"
+	CurrentSalts       = "CurrentSalts"
+	CurrentSaltVersion = "CurrentSaltVersion"
+)
+
+var _ vault.Vault = &MemoryProvider{}
+
+// Call is a recorded call to a MemoryProvider. Version is zero for methods that do not take one.
+type Call struct {
+	Method  string
+	Prefix  string
+	Version uint64
+}
+
+type fault struct {
+	err error
+	n   int // calls left before err is returned; zero returns it on every call
+}
+
+// MemoryProvider is a vault.Vault holding keys and salts in memory. It is safe for concurrent use.
+type MemoryProvider struct {
+	l           sync.Mutex
+	keys        map[string]map[uint64]*superdog.Key
+	currentKey  map[string]uint64
+	salts       map[string]map[uint64][]byte
+	activeSalts map[string][]uint64
+	currentSalt map[string]uint64
+	faults      map[string]*fault
+	latency     time.Duration
+	calls       []Call
+}
+
+// NewMemoryProvider returns an empty MemoryProvider.
+func NewMemoryProvider() *MemoryProvider {
+	return &MemoryProvider{
+		keys:        make(map[string]map[uint64]*superdog.Key),
+		currentKey:  make(map[string]uint64),
+		salts:       make(map[string]map[uint64][]byte),
+		activeSalts: make(map[string][]uint64),
+		currentSalt: make(map[string]uint64),
+		faults:      make(map[string]*fault),
+	}
+}
+
+// Install makes m the DefaultKeyProvider and DefaultSaltProvider, and returns a function restoring the previous ones.
+//
+//	defer m.Install()()
+func (m *MemoryProvider) Install() func() {
+	kp, sp := superdog.DefaultKeyProvider, superdog.DefaultSaltProvider
+	superdog.DefaultKeyProvider, superdog.DefaultSaltProvider = m, m
+	return func() {
+		superdog.DefaultKeyProvider, superdog.DefaultSaltProvider = kp, sp
+	}
+}
+
+// Rotate adds a random AES-256 GCM key as the next version of prefix, makes it current and returns its version.
+func (m *MemoryProvider) Rotate(prefix string) uint64 {
+	return m.RotateMode(prefix, superdog.GCM)
+}
+
+// RotateMode is Rotate with a key in the given block mode.
+func (m *MemoryProvider) RotateMode(prefix string, bm superdog.CipherBlockMode) uint64 {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	var version uint64
+	for v := range m.keys[prefix] {
+		if v > version {
+			version = v
+		}
+	}
+	version++
+
+	k, err := superdog.NewKey(version, superdog.AES, bm, random(32))
+	if err != nil {
+		panic(err)
+	}
+	if m.keys[prefix] == nil {
+		m.keys[prefix] = make(map[uint64]*superdog.Key)
+	}
+	m.keys[prefix][version] = k
+	m.currentKey[prefix] = version
+	return version
+}
+
+// AddKey stores k as version k.Version of prefix. It becomes the current version if it is the highest.
+func (m *MemoryProvider) AddKey(prefix string, k *superdog.Key) {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	if m.keys[prefix] == nil {
+		m.keys[prefix] = make(map[uint64]*superdog.Key)
+	}
+	m.keys[prefix][k.Version] = k
+	if k.Version > m.currentKey[prefix] {
+		m.currentKey[prefix] = k.Version
+	}
+}
+
+// SetKeyState changes the lifecycle state of a stored key version, e.g. to revoke it.
+func (m *MemoryProvider) SetKeyState(prefix string, version uint64, state superdog.KeyState) {
+	m.l.Lock()
+	defer m.l.Unlock()
+	k, ok := m.keys[prefix][version]
+	if !ok {
+		return
+	}
+
+	// keys already handed out keep their state; replace rather than modify
+	n, err := superdog.NewKey(k.Version, k.Cipher, k.CipherBlockMode, k.Bytes())
+	if err != nil {
+		panic(err)
+	}
+	n.Created, n.NotBefore, n.ExpiresAt, n.State = k.Created, k.NotBefore, k.ExpiresAt, state
+	m.keys[prefix][version] = n
+}
+
+// SetCurrentKeyVersion makes version the current key version of prefix, e.g. to roll back a rotation.
+func (m *MemoryProvider) SetCurrentKeyVersion(prefix string, version uint64) {
+	m.l.Lock()
+	defer m.l.Unlock()
+	m.currentKey[prefix] = version
+}
+
+// RotateSalt adds a random 32 byte salt as the next version of prefix, adds it to the active salts, makes it current
+// and returns its version.
+func (m *MemoryProvider) RotateSalt(prefix string) uint64 {
+	return m.AddSalt(prefix, random(32))
+}
+
+// AddSalt stores salt as the next version of prefix, as RotateSalt does.
+func (m *MemoryProvider) AddSalt(prefix string, salt []byte) uint64 {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	version := m.currentSalt[prefix] + 1
+	if m.salts[prefix] == nil {
+		m.salts[prefix] = make(map[uint64][]byte)
+	}
+	m.salts[prefix][version] = append([]byte(nil), salt...)
+	m.activeSalts[prefix] = append(m.activeSalts[prefix], version)
+	m.currentSalt[prefix] = version
+	return version
+}
+
+// RetireSalt removes version from the active salts of prefix. It can still be read with GetSalt.
+func (m *MemoryProvider) RetireSalt(prefix string, version uint64) {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	active := m.activeSalts[prefix][:0]
+	for _, v := range m.activeSalts[prefix] {
+		if v != version {
+			active = append(active, v)
+		}
+	}
+	m.activeSalts[prefix] = active
+}
+
+// SetError makes the nth call of method from now return err, counting from 1; n of zero makes every call fail.
+// A nil err removes the fault. Calls that fail are still recorded.
+func (m *MemoryProvider) SetError(method string, n int, err error) {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	if err == nil {
+		delete(m.faults, method)
+		return
+	}
+	m.faults[method] = &fault{err: err, n: n}
+}
+
+// SetLatency makes every call sleep for d before answering.
+func (m *MemoryProvider) SetLatency(d time.Duration) {
+	m.l.Lock()
+	defer m.l.Unlock()
+	m.latency = d
+}
+
+// Calls returns the calls made so far, in order.
+func (m *MemoryProvider) Calls() []Call {
+	m.l.Lock()
+	defer m.l.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// CallCount returns the number of calls made to method.
+func (m *MemoryProvider) CallCount(method string) int {
+	m.l.Lock()
+	defer m.l.Unlock()
+
+	n := 0
+	for _, c := range m.calls {
+		if c.Method == method {
+			n++
+		}
+	}
+	return n
+}
+
+// ResetCalls forgets the calls made so far.
+func (m *MemoryProvider) ResetCalls() {
+	m.l.Lock()
+	defer m.l.Unlock()
+	m.calls = nil
+}
+
+// GetKey returns version of prefix's key.
+func (m *MemoryProvider) GetKey(prefix string, version uint64) (*superdog.Key, error) {
+	if err := m.call(GetKey, prefix, version); err != nil {
+		return nil, err
+	}
+
+	m.l.Lock()
+	defer m.l.Unlock()
+	k, ok := m.keys[prefix][version]
+	if !ok {
+		return nil, superdog.ErrKeyNotFound
+	}
+	return k, nil
+}
+
+// CurrentKeyVersion returns the current key version of prefix.
+func (m *MemoryProvider) CurrentKeyVersion(prefix string) (uint64, error) {
+	if err := m.call(CurrentKeyVersion, prefix, 0); err != nil {
+		return 0, err
+	}
+
+	m.l.Lock()
+	defer m.l.Unlock()
+	v, ok := m.currentKey[prefix]
+	if !ok {
+		return 0, superdog.ErrKeyNotFound
+	}
+	return v, nil
+}
+
+// GetSalt returns version of prefix's salt.
+func (m *MemoryProvider) GetSalt(prefix string, version uint64) ([]byte, error) {
+	if err := m.call(GetSalt, prefix, version); err != nil {
+		return nil, err
+	}
+
+	m.l.Lock()
+	defer m.l.Unlock()
+	s, ok := m.salts[prefix][version]
+	if !ok {
+		return nil, superdog.ErrSaltNotFound
+	}
+	return append([]byte(nil), s...), nil
+}
+
+// CurrentSalts returns the active salt versions of prefix.
+func (m *MemoryProvider) CurrentSalts(prefix string) ([]uint64, error) {
+	if err := m.call(CurrentSalts, prefix, 0); err != nil {
+		return nil, err
+	}
+
+	m.l.Lock()
+	defer m.l.Unlock()
+	if _, ok := m.currentSalt[prefix]; !ok {
+		return nil, superdog.ErrSaltNotFound
+	}
+	return append([]uint64(nil), m.activeSalts[prefix]...), nil
+}
+
+// CurrentSaltVersion returns the current salt version of prefix.
+func (m *MemoryProvider) CurrentSaltVersion(prefix string) (uint64, error) {
+	if err := m.call(CurrentSaltVersion, prefix, 0); err != nil {
+		return 0, err
+	}
+
+	m.l.Lock()
+	defer m.l.Unlock()
+	v, ok := m.currentSalt[prefix]
+	if !ok {
+		return 0, superdog.ErrSaltNotFound
+	}
+	return v, nil
+}
+
+// call records a call, waits for the configured latency and returns the injected error, if any.
+func (m *MemoryProvider) call(method, prefix string, version uint64) error {
+	m.l.Lock()
+	m.calls = append(m.calls, Call{Method: method, Prefix: prefix, Version: version})
+	latency := m.latency
+
+	var err error
+	if f, ok := m.faults[method]; ok {
+		switch {
+		case f.n == 0:
+			err = f.err
+		case f.n == 1:
+			err = f.err
+			delete(m.faults, method)
+		default:
+			f.n--
+		}
+	}
+	m.l.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	return err
+}
+
+func random(n int) []byte {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,109 @@
+package superdogtest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/xordataexchange/superdog"
+)
+
+func TestMemoryProviderRotate(t *testing.T) {
+	m := NewMemoryProvider()
+	defer m.Install()()
+
+	m.Rotate("ssn")
+	m.RotateSalt("ssn")
+
+	b, err := superdog.Encrypt("ssn", nil, []byte("123-45-6789"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertEncryptedWith(t, b, "ssn", 1)
+
+	if v := m.Rotate("ssn"); v != 2 {
+		t.Fatal("Expected version 2, got", v)
+	}
+	b, err = superdog.Reencrypt("ssn", b, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	AssertEncryptedWith(t, b, "ssn", 2)
+	AssertDecryptsTo(t, b, "ssn", []byte("123-45-6789"))
+
+	m.SetCurrentKeyVersion("ssn", 1)
+	if v := m.Rotate("ssn"); v != 3 {
+		t.Fatal("Expected rotation after a rollback to use a new version, got", v)
+	}
+
+	m.RotateSalt("ssn")
+	m.RetireSalt("ssn", 1)
+	if salts, _ := m.CurrentSalts("ssn"); len(salts) != 1 || salts[0] != 2 {
+		t.Fatal("Expected only salt 2 to be active", salts)
+	}
+	if _, err := m.GetSalt("ssn", 1); err != nil {
+		t.Fatal("Expected retired salt to remain readable", err)
+	}
+
+	if _, err := m.CurrentKeyVersion("dob"); err != superdog.ErrKeyNotFound {
+		t.Fatal("Expected key not found error, got", err)
+	}
+}
+
+func TestAssertUnauthenticatedModes(t *testing.T) {
+	m := NewMemoryProvider()
+	defer m.Install()()
+
+	for _, bm := range []superdog.CipherBlockMode{superdog.CFB, superdog.CTR, superdog.OFB} {
+		v := m.RotateMode("ssn", bm)
+		b, err := superdog.Encrypt("ssn", nil, []byte("123-45-6789"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		AssertEncryptedWith(t, b, "ssn", v)
+		AssertDecryptsTo(t, b, "ssn", []byte("123-45-6789"))
+	}
+}
+
+func TestMemoryProviderFaults(t *testing.T) {
+	m := NewMemoryProvider()
+	m.Rotate("ssn")
+	errDown := errors.New("down")
+
+	m.SetError(GetKey, 2, errDown)
+	for i, want := range []error{nil, errDown, nil} {
+		if _, err := m.GetKey("ssn", 1); err != want {
+			t.Fatal("Unexpected error on call", i+1, err)
+		}
+	}
+
+	m.SetError(CurrentKeyVersion, 0, errDown)
+	for i := 0; i < 2; i++ {
+		if _, err := m.CurrentKeyVersion("ssn"); err != errDown {
+			t.Fatal("Expected every call to fail, got", err)
+		}
+	}
+	m.SetError(CurrentKeyVersion, 0, nil)
+	if _, err := m.CurrentKeyVersion("ssn"); err != nil {
+		t.Fatal("Expected fault to be cleared", err)
+	}
+
+	m.SetLatency(10 * time.Millisecond)
+	start := time.Now()
+	m.GetKey("ssn", 1)
+	if time.Since(start) < 10*time.Millisecond {
+		t.Fatal("Expected latency to be added")
+	}
+
+	calls := m.Calls()
+	if len(calls) != 7 || calls[0] != (Call{GetKey, "ssn", 1}) || calls[3].Method != CurrentKeyVersion {
+		t.Fatal("Unexpected call log", calls)
+	}
+	if n := m.CallCount(GetKey); n != 4 {
+		t.Fatal("Expected 4 GetKey calls, got", n)
+	}
+	m.ResetCalls()
+	if len(m.Calls()) != 0 {
+		t.Fatal("Expected call log to be reset")
+	}
+}
@@ -0,0 +1,86 @@
+package superdog
+
+import (
+	"context"
+)
+
+// Span attribute keys. Spans never carry plaintext, ciphertext or key material.
+const (
+	AttrPrefix      = "superdog.prefix"
+	AttrKeyVersion  = "superdog.key_version"
+	AttrSaltVersion = "superdog.salt_version"
+	AttrMode        = "superdog.mode"
+	AttrCacheHit    = "superdog.cache_hit"
+)
+
+// Tracer starts spans around operations and provider calls, e.g. to export them to OpenTelemetry.
+// Implementations must be safe for concurrent use.
+type Tracer interface {
+	// Start starts a span named name as a child of the span in ctx, if any, and returns a context holding it.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// SetAttribute records an attribute. value is a string, uint64 or bool.
+	SetAttribute(key string, value interface{})
+	// End ends the span, marking it failed if err is not nil.
+	End(err error)
+}
+
+// NopTracer starts spans that record nothing.
+type NopTracer struct{}
+
+var _ Tracer = NopTracer{}
+
+func (NopTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttribute(key string, value interface{}) {
+}
+
+func (nopSpan) End(err error) {
+}
+
+// DefaultTracer starts the spans of the package functions and the providers in vault.
+var DefaultTracer Tracer = NopTracer{}
+
+// begin starts the span of an operation on prefix.
+func begin(ctx context.Context, name, prefix string) (context.Context, Span) {
+	ctx, span := DefaultTracer.Start(ctx, name)
+	span.SetAttribute(AttrPrefix, prefix)
+	return ctx, span
+}
+
+// ContextKeyProvider is a KeyProvider whose lookups take the context of the operation they are made for, so they
+// can be traced. The package functions use these methods when DefaultKeyProvider has them.
+type ContextKeyProvider interface {
+	KeyProvider
+	GetKeyContext(ctx context.Context, prefix string, version uint64) (*Key, error)
+	CurrentKeyVersionContext(ctx context.Context, prefix string) (uint64, error)
+}
+
+// ContextSaltProvider is a SaltProvider whose lookups take the context of the operation they are made for.
+type ContextSaltProvider interface {
+	SaltProvider
+	CurrentSaltsContext(ctx context.Context, prefix string) ([]uint64, error)
+	GetSaltContext(ctx context.Context, prefix string, version uint64) ([]byte, error)
+	CurrentSaltVersionContext(ctx context.Context, prefix string) (uint64, error)
+}
+
+// currentKeyVersion asks DefaultKeyProvider for the current key version of prefix, passing ctx if it takes one.
+func currentKeyVersion(ctx context.Context, prefix string) (uint64, error) {
+	var (
+		v   uint64
+		err error
+	)
+	if kp, ok := DefaultKeyProvider.(ContextKeyProvider); ok {
+		v, err = kp.CurrentKeyVersionContext(ctx, prefix)
+	} else {
+		v, err = DefaultKeyProvider.CurrentKeyVersion(prefix)
+	}
+	return v, keyError(prefix, 0, err)
+}
@@ -0,0 +1,15 @@
+/*
+See LICENSE file for license details
+Copyright (c) 2015 XOR Data Exchange, Inc.
+
+
+Package otel exports superdog's spans to OpenTelemetry. Make a Tracer the default, and pass request contexts to
+the Context variants of the package functions, e.g. superdog.EncryptContext:
+
+	superdog.DefaultTracer = otel.New(nil)
+
+Encrypt, Decrypt, Reencrypt and Hash are traced, with child spans for the lookups of providers that take contexts,
+such as hashi.Vault. Spans carry the prefix, key or salt version, block mode and whether a lookup was cached, but
+never plaintext, ciphertext or key material.
+*/
+package otel
@@ -0,0 +1,57 @@
+package otel
+
+import (
+	"context"
+
+	"github.com/xordataexchange/superdog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName is the name of the OpenTelemetry tracer spans are created with.
+const InstrumentationName = "github.com/xordataexchange/superdog"
+
+var _ superdog.Tracer = &Tracer{}
+
+// Tracer is a superdog.Tracer creating OpenTelemetry spans.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// New returns a Tracer creating spans with tp, or with the global TracerProvider if tp is nil.
+func New(tp trace.TracerProvider) *Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &Tracer{tracer: tp.Tracer(InstrumentationName)}
+}
+
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, superdog.Span) {
+	ctx, s := t.tracer.Start(ctx, name)
+	return ctx, span{s}
+}
+
+type span struct {
+	s trace.Span
+}
+
+func (s span) SetAttribute(key string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		s.s.SetAttributes(attribute.String(key, v))
+	case bool:
+		s.s.SetAttributes(attribute.Bool(key, v))
+	case uint64:
+		s.s.SetAttributes(attribute.Int64(key, int64(v)))
+	}
+}
+
+func (s span) End(err error) {
+	if err != nil {
+		s.s.RecordError(err)
+		s.s.SetStatus(codes.Error, err.Error())
+	}
+	s.s.End()
+}
@@ -0,0 +1,80 @@
+package otel
+
+import (
+	"context"
+	"testing"
+
+	"github.com/xordataexchange/superdog"
+	"github.com/xordataexchange/superdog/superdogtest"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// provider answers key lookups with a context, so they are traced as child spans.
+type provider struct {
+	*superdogtest.MemoryProvider
+}
+
+func (p *provider) GetKeyContext(ctx context.Context, prefix string, version uint64) (*superdog.Key, error) {
+	_, span := superdog.DefaultTracer.Start(ctx, "test.GetKey")
+	defer span.End(nil)
+	span.SetAttribute(superdog.AttrCacheHit, false)
+	return p.GetKey(prefix, version)
+}
+
+func (p *provider) CurrentKeyVersionContext(ctx context.Context, prefix string) (uint64, error) {
+	return p.CurrentKeyVersion(prefix)
+}
+
+func TestTracer(t *testing.T) {
+	defer func(kp superdog.KeyProvider) { superdog.DefaultKeyProvider = kp }(superdog.DefaultKeyProvider)
+	defer func(t superdog.Tracer) { superdog.DefaultTracer = t }(superdog.DefaultTracer)
+	keys := superdogtest.NewMemoryProvider()
+	for i := 0; i < 3; i++ {
+		keys.Rotate("ssn")
+	}
+	superdog.DefaultKeyProvider = &provider{keys}
+
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	superdog.DefaultTracer = New(tp)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "request")
+	b, err := superdog.EncryptContext(ctx, "ssn", nil, []byte("secret value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[len(b)-1] ^= 1
+	superdog.DecryptContext(ctx, "ssn", nil, b)
+	parent.End()
+
+	spans := rec.Ended()
+	if len(spans) != 5 {
+		t.Fatal("Expected 5 spans, got", len(spans))
+	}
+	lookup, encrypt, decrypt := spans[0], spans[1], spans[3]
+	if encrypt.Name() != "superdog.Encrypt" || encrypt.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Fatal("Expected an encrypt span under the request span", encrypt.Name())
+	}
+	if lookup.Name() != "test.GetKey" || lookup.Parent().SpanID() != encrypt.SpanContext().SpanID() {
+		t.Fatal("Expected the key lookup to be a child of the encrypt span", lookup.Name())
+	}
+
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, a := range encrypt.Attributes() {
+		attrs[a.Key] = a.Value
+	}
+	if attrs[superdog.AttrPrefix].AsString() != "ssn" || attrs[superdog.AttrKeyVersion].AsInt64() != 3 || attrs[superdog.AttrMode].AsString() != "GCM" {
+		t.Fatal("Unexpected encrypt span attributes", encrypt.Attributes())
+	}
+	for _, a := range encrypt.Attributes() {
+		if a.Value.AsString() == "secret value" {
+			t.Fatal("Expected plaintext not to be recorded")
+		}
+	}
+
+	if decrypt.Name() != "superdog.Decrypt" || decrypt.Status().Code.String() != "Error" {
+		t.Fatal("Expected the failed decryption to be marked as an error", decrypt.Name(), decrypt.Status())
+	}
+}
@@ -0,0 +1,168 @@
+package superdog
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// GCMNonceLimit is the number of messages a GCM key with random 96 bit nonces should encrypt at most. Beyond it
+// the chance of a repeated nonce, which breaks GCM, exceeds 2^-32 (NIST SP 800-38D).
+const GCMNonceLimit uint64 = 1 << 32
+
+// DefaultWarnAt are the fractions of the limit at which UsageLimits warns when WarnAt is empty.
+var DefaultWarnAt = []float64{0.5, 0.75, 0.9}
+
+// ErrUsageLimit is wrapped by a UsageError when a key that has reached its encryption limit is used to encrypt.
+var ErrUsageLimit = errors.New("Key has reached its encryption limit")
+
+// UsageError is returned by Encrypt when UsageLimits refuses a key.
+type UsageError struct {
+	Prefix  string
+	Version uint64
+	Count   uint64
+}
+
+func (e *UsageError) Error() string {
+	return fmt.Sprintf("Key %s version %d has encrypted %d messages: %v", e.Prefix, e.Version, e.Count, ErrUsageLimit)
+}
+
+func (e *UsageError) Unwrap() error {
+	return ErrUsageLimit
+}
+
+// CounterStore counts the messages encrypted with each key version. A store shared between processes, such as a
+// database table, makes the counts and limits cover every process using the keys.
+type CounterStore interface {
+	// Add adds n to the count of prefix and version and returns the new count.
+	Add(prefix string, version uint64, n uint64) (uint64, error)
+	// Count returns the count of prefix and version.
+	Count(prefix string, version uint64) (uint64, error)
+}
+
+type counterKey struct {
+	prefix  string
+	version uint64
+}
+
+// MemoryCounterStore is a CounterStore for a single process. Its counts start at zero whenever the process starts.
+// Each key version has its own atomic counter, so concurrent encryptions do not contend on a lock.
+type MemoryCounterStore struct {
+	counts sync.Map // counterKey to *atomic.Uint64
+}
+
+var _ CounterStore = &MemoryCounterStore{}
+
+func NewMemoryCounterStore() *MemoryCounterStore {
+	return &MemoryCounterStore{}
+}
+
+func (s *MemoryCounterStore) Add(prefix string, version uint64, n uint64) (uint64, error) {
+	k := counterKey{prefix, version}
+	c, ok := s.counts.Load(k)
+	if !ok {
+		c, _ = s.counts.LoadOrStore(k, new(atomic.Uint64))
+	}
+	return c.(*atomic.Uint64).Add(n), nil
+}
+
+func (s *MemoryCounterStore) Count(prefix string, version uint64) (uint64, error) {
+	c, ok := s.counts.Load(counterKey{prefix, version})
+	if !ok {
+		return 0, nil
+	}
+	return c.(*atomic.Uint64).Load(), nil
+}
+
+// UsageLimits counts the messages encrypted with GCM keys and acts as they approach Limit. Other block modes use
+// 128 bit IVs and are not counted.
+type UsageLimits struct {
+	Store  CounterStore // Where counts are kept; nil disables counting
+	Limit  uint64       // Messages per key version; zero is GCMNonceLimit
+	WarnAt []float64    // Fractions of Limit at which OnWarn is called; empty is DefaultWarnAt
+
+	// Refuse makes Encrypt fail with a *UsageError once a key version has encrypted Limit messages. It also makes
+	// Encrypt fail when Store does.
+	Refuse bool
+
+	// OnWarn is called once each time a count reaches one of WarnAt. By default it logs.
+	OnWarn func(prefix string, version uint64, count uint64)
+	// OnLimit is called once when a count reaches Limit, e.g. to rotate the key of prefix. Without it OnWarn is
+	// called instead.
+	OnLimit func(prefix string, version uint64, count uint64)
+	// OnError is called when Store fails and Refuse is not set.
+	OnError func(err error)
+}
+
+// usageLimits are the limits applied by Encrypt and EncryptWithVersion. By default they count in memory and warn, but
+// do not refuse keys.
+var usageLimits atomic.Pointer[UsageLimits]
+
+func init() {
+	usageLimits.Store(&UsageLimits{Store: NewMemoryCounterStore()})
+}
+
+// SetUsageLimits sets the limits applied by Encrypt and EncryptWithVersion. UsageLimits{} disables counting.
+func SetUsageLimits(u UsageLimits) {
+	usageLimits.Store(&u)
+}
+
+// CurrentUsageLimits returns the limits applied by Encrypt and EncryptWithVersion.
+func CurrentUsageLimits() UsageLimits {
+	return *usageLimits.Load()
+}
+
+// count adds one message encrypted with k to the count of prefix, calling the callbacks of u for any threshold it
+// reaches. It returns an error if u refuses the key.
+func (u UsageLimits) count(prefix string, k *Key) error {
+	if u.Store == nil || k.CipherBlockMode != GCM {
+		return nil
+	}
+
+	n, err := u.Store.Add(prefix, k.Version, 1)
+	if err != nil {
+		if u.Refuse {
+			return err
+		}
+		if u.OnError != nil {
+			u.OnError(err)
+		}
+		return nil
+	}
+
+	limit := u.Limit
+	if limit == 0 {
+		limit = GCMNonceLimit
+	}
+	if n > limit && u.Refuse {
+		return &UsageError{Prefix: prefix, Version: k.Version, Count: n}
+	}
+
+	warnAt := u.WarnAt
+	if len(warnAt) == 0 {
+		warnAt = DefaultWarnAt
+	}
+	for _, f := range warnAt {
+		if n == uint64(f*float64(limit)) {
+			u.warn(prefix, k.Version, n, limit)
+		}
+	}
+	if n == limit {
+		if u.OnLimit != nil {
+			u.OnLimit(prefix, k.Version, n)
+		} else {
+			u.warn(prefix, k.Version, n, limit)
+		}
+	}
+	return nil
+}
+
+func (u UsageLimits) warn(prefix string, version uint64, n, limit uint64) {
+	if u.OnWarn != nil {
+		u.OnWarn(prefix, version, n)
+		return
+	}
+	LoggerOrDefault(nil).Warn("Key is approaching its encryption limit, rotate it",
+		AttrPrefix, prefix, AttrKeyVersion, version, "count", n, "limit", limit)
+}
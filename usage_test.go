@@ -0,0 +1,108 @@
+package superdog
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestUsageLimits(t *testing.T) {
+	defer func(kp KeyProvider) { DefaultKeyProvider = kp }(DefaultKeyProvider)
+	defer SetUsageLimits(CurrentUsageLimits())
+
+	gcm, _ := NewKey(1, AES, GCM, make([]byte, 32))
+	cfb, _ := NewKey(2, AES, CFB, make([]byte, 32))
+	DefaultKeyProvider = fixedKeys{1: gcm, 2: cfb}
+
+	var warned []uint64
+	var limited int
+	store := NewMemoryCounterStore()
+	SetUsageLimits(UsageLimits{
+		Store:   store,
+		Limit:   10,
+		WarnAt:  []float64{0.5, 0.9},
+		OnWarn:  func(prefix string, version uint64, count uint64) { warned = append(warned, count) },
+		OnLimit: func(prefix string, version uint64, count uint64) { limited++ },
+	})
+
+	for i := 0; i < 12; i++ {
+		if _, err := EncryptWithVersion("ssn", 1, nil, []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(warned) != 2 || warned[0] != 5 || warned[1] != 9 {
+		t.Fatal("Expected warnings at 5 and 9 messages", warned)
+	}
+	if limited != 1 {
+		t.Fatal("Expected the limit callback once, got", limited)
+	}
+	if n, _ := store.Count("ssn", 1); n != 12 {
+		t.Fatal("Expected 12 messages to be counted, got", n)
+	}
+
+	u := CurrentUsageLimits()
+	u.Refuse = true
+	SetUsageLimits(u)
+	_, err := EncryptWithVersion("ssn", 1, nil, []byte("value"))
+	var usageErr *UsageError
+	if !errors.As(err, &usageErr) || usageErr.Version != 1 || usageErr.Count != 13 || !errors.Is(err, ErrUsageLimit) {
+		t.Fatal("Expected usage limit error, got", err)
+	}
+	if _, err := EncryptWithVersion("ssn", 2, nil, []byte("value")); err != nil {
+		t.Fatal("Expected CFB keys not to be counted", err)
+	}
+	if _, err := EncryptWithVersion("other", 1, nil, []byte("value")); err != nil {
+		t.Fatal("Expected counts to be kept per prefix", err)
+	}
+}
+
+// evictingKeys returns a destroyed key for the first request, as if the provider evicted it right after returning it.
+type evictingKeys struct {
+	fixedKeys
+	evicted bool
+}
+
+func (e *evictingKeys) GetKey(prefix string, version uint64) (*Key, error) {
+	if !e.evicted {
+		e.evicted = true
+		k, _ := NewKey(version, AES, GCM, make([]byte, 32))
+		k.Destroy()
+		return k, nil
+	}
+	return e.fixedKeys.GetKey(prefix, version)
+}
+
+func TestUsageCountsRetryOnce(t *testing.T) {
+	defer func(kp KeyProvider) { DefaultKeyProvider = kp }(DefaultKeyProvider)
+	defer SetUsageLimits(CurrentUsageLimits())
+
+	k, _ := NewKey(1, AES, GCM, make([]byte, 32))
+	DefaultKeyProvider = &evictingKeys{fixedKeys: fixedKeys{1: k}}
+	store := NewMemoryCounterStore()
+	SetUsageLimits(UsageLimits{Store: store})
+
+	if _, err := EncryptWithVersion("ssn", 1, nil, []byte("value")); err != nil {
+		t.Fatal("Expected the evicted key to be fetched again", err)
+	}
+	if n, _ := store.Count("ssn", 1); n != 1 {
+		t.Fatal("Expected the message to be counted once, got", n)
+	}
+}
+
+func TestMemoryCounterStoreConcurrent(t *testing.T) {
+	s := NewMemoryCounterStore()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				s.Add("ssn", 1, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n, _ := s.Count("ssn", 1); n != 8000 {
+		t.Fatal("Expected 8000 messages to be counted, got", n)
+	}
+}
@@ -0,0 +1,143 @@
+package chain
+
+import (
+	"errors"
+	"path"
+
+	"github.com/xordataexchange/superdog"
+	"github.com/xordataexchange/superdog/vault"
+)
+
+// ErrNoRoute is returned for a prefix that matches no route.
+var ErrNoRoute = errors.New("No provider configured for prefix")
+
+var _ vault.Vault = &Chain{}
+
+// Route sends the prefixes matching Pattern to a set of providers.
+type Route struct {
+	// Pattern is matched against prefixes with path.Match, e.g. "fields/*". An empty pattern matches every prefix.
+	Pattern string
+
+	// Keys are asked for a key version in order, moving on to the next when one returns superdog.ErrKeyNotFound.
+	Keys []superdog.KeyProvider
+	// CurrentKeys answers CurrentKeyVersion. It defaults to the first of Keys.
+	CurrentKeys superdog.KeyProvider
+
+	// Salts are asked for a salt version in order, moving on to the next when one returns superdog.ErrSaltNotFound.
+	Salts []superdog.SaltProvider
+	// CurrentSalts answers CurrentSalts and CurrentSaltVersion. It defaults to the first of Salts.
+	CurrentSalts superdog.SaltProvider
+}
+
+// Chain routes each prefix to the first Route whose pattern matches it.
+type Chain struct {
+	Routes []Route
+}
+
+// New returns a Chain with the given routes, which are tried in order.
+func New(routes ...Route) *Chain {
+	return &Chain{Routes: routes}
+}
+
+func (c *Chain) route(prefix string) (*Route, error) {
+	for i := range c.Routes {
+		r := &c.Routes[i]
+		if r.Pattern == "" {
+			return r, nil
+		}
+		ok, err := path.Match(r.Pattern, prefix)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return r, nil
+		}
+	}
+	return nil, ErrNoRoute
+}
+
+// GetKey returns the key from the first provider on the prefix's route that has it.
+func (c *Chain) GetKey(prefix string, version uint64) (*superdog.Key, error) {
+	r, err := c.route(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	err = superdog.ErrKeyNotFound
+	for _, kp := range r.Keys {
+		var k *superdog.Key
+		k, err = kp.GetKey(prefix, version)
+		if !errors.Is(err, superdog.ErrKeyNotFound) {
+			return k, err
+		}
+	}
+	return nil, err
+}
+
+// CurrentKeyVersion returns the current key version from the route's authoritative key provider.
+func (c *Chain) CurrentKeyVersion(prefix string) (uint64, error) {
+	r, err := c.route(prefix)
+	if err != nil {
+		return 0, err
+	}
+
+	kp := r.CurrentKeys
+	if kp == nil {
+		if len(r.Keys) == 0 {
+			return 0, superdog.ErrKeyNotFound
+		}
+		kp = r.Keys[0]
+	}
+	return kp.CurrentKeyVersion(prefix)
+}
+
+// GetSalt returns the salt from the first provider on the prefix's route that has it.
+func (c *Chain) GetSalt(prefix string, version uint64) ([]byte, error) {
+	r, err := c.route(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	err = superdog.ErrSaltNotFound
+	for _, sp := range r.Salts {
+		var s []byte
+		s, err = sp.GetSalt(prefix, version)
+		if !errors.Is(err, superdog.ErrSaltNotFound) {
+			return s, err
+		}
+	}
+	return nil, err
+}
+
+// CurrentSalts returns the active salt versions from the route's authoritative salt provider.
+func (c *Chain) CurrentSalts(prefix string) ([]uint64, error) {
+	sp, err := c.currentSalts(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return sp.CurrentSalts(prefix)
+}
+
+// CurrentSaltVersion returns the current salt version from the route's authoritative salt provider.
+func (c *Chain) CurrentSaltVersion(prefix string) (uint64, error) {
+	sp, err := c.currentSalts(prefix)
+	if err != nil {
+		return 0, err
+	}
+	return sp.CurrentSaltVersion(prefix)
+}
+
+func (c *Chain) currentSalts(prefix string) (superdog.SaltProvider, error) {
+	r, err := c.route(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.CurrentSalts != nil {
+		return r.CurrentSalts, nil
+	}
+	if len(r.Salts) == 0 {
+		return nil, superdog.ErrSaltNotFound
+	}
+	return r.Salts[0], nil
+}
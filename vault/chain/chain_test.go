@@ -0,0 +1,95 @@
+package chain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/xordataexchange/superdog"
+	"github.com/xordataexchange/superdog/vault/keyring"
+)
+
+// migrating returns providers for a migration where the old store holds versions 1 and 2 and the new store holds version 3.
+func migrating(t *testing.T) (*keyring.Keyring, *keyring.Keyring) {
+	old, next := keyring.New(), keyring.New()
+	for _, prefix := range []string{"fields/ssn", "legacy/dob"} {
+		old.GenerateKey(prefix, superdog.AES, superdog.CFB, 32)
+		old.GenerateKey(prefix, superdog.AES, superdog.GCM, 32)
+		old.AddSalt(prefix, []byte("old salt"))
+	}
+
+	next.AddKey("fields/ssn", superdog.AES, superdog.GCM, bytes.Repeat([]byte{1}, 32))
+	next.AddKey("fields/ssn", superdog.AES, superdog.GCM, bytes.Repeat([]byte{2}, 32))
+	next.AddKey("fields/ssn", superdog.AES, superdog.GCM, bytes.Repeat([]byte{3}, 32))
+	next.AddSalt("fields/ssn", []byte("new salt"))
+	return old, next
+}
+
+func TestChainFallback(t *testing.T) {
+	old, next := migrating(t)
+	c := New(
+		Route{Pattern: "legacy/*", Keys: []superdog.KeyProvider{old}, Salts: []superdog.SaltProvider{old}},
+		Route{Keys: []superdog.KeyProvider{next, old}, Salts: []superdog.SaltProvider{next, old}},
+	)
+
+	version, err := c.CurrentKeyVersion("fields/ssn")
+	if err != nil || version != 3 {
+		t.Fatal("Expected current version from the primary provider", version, err)
+	}
+
+	k, err := c.GetKey("fields/ssn", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.CipherBlockMode != superdog.GCM {
+		t.Fatal("Expected primary provider's version 1 to be used")
+	}
+
+	if _, err := c.GetKey("fields/ssn", 4); err != superdog.ErrKeyNotFound {
+		t.Fatal("Expected key not found error, got", err)
+	}
+
+	version, err = c.CurrentKeyVersion("legacy/dob")
+	if err != nil || version != 2 {
+		t.Fatal("Expected legacy prefix to be routed to the old provider", version, err)
+	}
+
+	s, err := c.GetSalt("legacy/dob", 1)
+	if err != nil || !bytes.Equal(s, []byte("old salt")) {
+		t.Fatal("Expected legacy salt", err)
+	}
+}
+
+func TestChainAuthoritative(t *testing.T) {
+	old, next := migrating(t)
+	c := New(Route{
+		Keys:         []superdog.KeyProvider{old, next},
+		CurrentKeys:  next,
+		Salts:        []superdog.SaltProvider{old, next},
+		CurrentSalts: next,
+	})
+
+	version, err := c.CurrentKeyVersion("fields/ssn")
+	if err != nil || version != 3 {
+		t.Fatal("Expected current version from the authoritative provider", version, err)
+	}
+
+	k, err := c.GetKey("fields/ssn", 3)
+	if err != nil || k.Version != 3 {
+		t.Fatal("Expected fallback to the secondary provider", err)
+	}
+
+	s, err := c.GetSalt("fields/ssn", 1)
+	if err != nil || !bytes.Equal(s, []byte("old salt")) {
+		t.Fatal("Expected first salt provider to be tried first", err)
+	}
+	if version, _ := c.CurrentSaltVersion("fields/ssn"); version != 1 {
+		t.Fatal("Expected current salt version from the authoritative provider")
+	}
+}
+
+func TestChainNoRoute(t *testing.T) {
+	c := New(Route{Pattern: "fields/*"})
+	if _, err := c.GetKey("other", 1); err != ErrNoRoute {
+		t.Fatal("Expected no route error, got", err)
+	}
+}
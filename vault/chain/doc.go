@@ -0,0 +1,10 @@
+/*
+See LICENSE file for license details
+Copyright (c) 2015 XOR Data Exchange, Inc.
+
+
+Package chain provides an implementation of the vault interface that composes other providers, routing each prefix
+to its own providers and falling back to secondary providers for keys and salts the primary does not have.
+It is intended for migrations between backends, where old versions live in one store and new versions in another.
+*/
+package chain
@@ -0,0 +1,409 @@
+package diskcache
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/xordataexchange/superdog"
+	"github.com/xordataexchange/superdog/vault"
+)
+
+// confirmInterval is how often the fetch time of an entry the provider keeps returning is updated and written.
+const confirmInterval = time.Minute
+
+var _ vault.Vault = &Cache{}
+
+// Cache wraps a provider, recording everything it returns and answering from the recorded copy when the provider is
+// unavailable, i.e. fails with superdog.ErrProviderUnavailable. Other failures, such as a version that does not exist
+// or a denied request, are passed through and never answered from the cache.
+type Cache struct {
+	// OnError is called when the cache file could not be written.
+	OnError func(err error)
+
+	upstream vault.Vault
+	path     string
+	maxAge   time.Duration
+	secret   []byte
+
+	l sync.RWMutex
+	c contents
+}
+
+// contents is the plaintext of the cache file.
+type contents struct {
+	Prefixes map[string]*entries `json:"prefixes"`
+}
+
+// entries are the recorded answers for one prefix.
+type entries struct {
+	CurrentKey  *current              `json:"current_key,omitempty"`
+	CurrentSalt *current              `json:"current_salt,omitempty"`
+	ActiveSalts *current              `json:"active_salts,omitempty"`
+	Keys        map[uint64]*keyEntry  `json:"keys,omitempty"`
+	Salts       map[uint64]*saltEntry `json:"salts,omitempty"`
+}
+
+type current struct {
+	Version uint64    `json:"version"`
+	Salts   []uint64  `json:"salts,omitempty"`
+	Fetched time.Time `json:"fetched"`
+}
+
+type keyEntry struct {
+	Cipher    string    `json:"cipher"`
+	BlockMode string    `json:"block_mode"`
+	Key       []byte    `json:"key"`
+	Created   time.Time `json:"created_at"`
+	NotBefore time.Time `json:"not_before"`
+	ExpiresAt time.Time `json:"expires_at"`
+	State     string    `json:"state"`
+	Fetched   time.Time `json:"fetched"`
+
+	key *superdog.Key // the key last returned by the provider, to skip recording it again
+}
+
+type saltEntry struct {
+	Salt    []byte    `json:"salt"`
+	Fetched time.Time `json:"fetched"`
+}
+
+// New returns a Cache in front of upstream, stored at path and sealed with a key derived from secret. The secret
+// should be readable only by the process, e.g. from a secret store; a value any user of the host can read, such as the
+// machine ID, does not protect the file.
+// Recorded entries older than maxAge are not served; zero serves them regardless of age.
+// An existing file at path is loaded; one that cannot be unsealed, e.g. because it was written on another machine, is ignored.
+func New(upstream vault.Vault, path string, secret []byte, maxAge time.Duration) (*Cache, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("Disk cache secret must not be empty")
+	}
+
+	c := &Cache{
+		upstream: upstream,
+		path:     path,
+		maxAge:   maxAge,
+		secret:   append([]byte(nil), secret...),
+		c:        contents{Prefixes: make(map[string]*entries)},
+	}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := unseal(b, c.secret)
+	if err != nil {
+		return c, nil
+	}
+	var loaded contents
+	if err := json.Unmarshal(plain, &loaded); err == nil && loaded.Prefixes != nil {
+		c.c = loaded
+	}
+	return c, nil
+}
+
+// GetKey returns the key from the provider, or the recorded key if the provider is unavailable.
+func (c *Cache) GetKey(prefix string, version uint64) (*superdog.Key, error) {
+	k, err := c.upstream.GetKey(prefix, version)
+	if err == nil {
+		if !c.confirmed(prefix, version, k) {
+			c.update(prefix, func(p *entries) bool {
+				return p.recordKey(version, k, c.due)
+			})
+		}
+		return k, nil
+	}
+	if !errors.Is(err, superdog.ErrProviderUnavailable) {
+		return nil, err
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	p, ok := c.c.Prefixes[prefix]
+	if !ok {
+		return nil, err
+	}
+	e, ok := p.Keys[version]
+	if !ok || !c.fresh(e.Fetched) {
+		return nil, err
+	}
+
+	cipher, perr := superdog.ParseCipher(e.Cipher)
+	if perr != nil {
+		return nil, err
+	}
+	bm, perr := superdog.ParseCipherBlockMode(e.BlockMode)
+	if perr != nil {
+		return nil, err
+	}
+	state, perr := superdog.ParseKeyState(e.State)
+	if perr != nil {
+		return nil, err
+	}
+	k, kerr := superdog.NewKey(version, cipher, bm, e.Key)
+	if kerr != nil {
+		return nil, err
+	}
+	k.Created, k.NotBefore, k.ExpiresAt, k.State = e.Created, e.NotBefore, e.ExpiresAt, state
+	return k, nil
+}
+
+// CurrentKeyVersion returns the current key version from the provider, or the recorded one if the provider is unavailable.
+func (c *Cache) CurrentKeyVersion(prefix string) (uint64, error) {
+	v, err := c.upstream.CurrentKeyVersion(prefix)
+	if err == nil {
+		c.update(prefix, func(p *entries) bool {
+			old := p.CurrentKey
+			if old != nil && old.Version == v && !c.due(old.Fetched) {
+				return false
+			}
+			p.CurrentKey = &current{Version: v, Fetched: time.Now()}
+			return true
+		})
+		return v, nil
+	}
+	if !errors.Is(err, superdog.ErrProviderUnavailable) {
+		return 0, err
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if p, ok := c.c.Prefixes[prefix]; ok && p.CurrentKey != nil && c.fresh(p.CurrentKey.Fetched) {
+		return p.CurrentKey.Version, nil
+	}
+	return 0, err
+}
+
+// GetSalt returns the salt from the provider, or the recorded salt if the provider is unavailable.
+func (c *Cache) GetSalt(prefix string, version uint64) ([]byte, error) {
+	s, err := c.upstream.GetSalt(prefix, version)
+	if err == nil {
+		c.update(prefix, func(p *entries) bool {
+			old := p.Salts[version]
+			if old != nil && bytes.Equal(old.Salt, s) && !c.due(old.Fetched) {
+				return false
+			}
+			p.Salts[version] = &saltEntry{Salt: append([]byte(nil), s...), Fetched: time.Now()}
+			return true
+		})
+		return s, nil
+	}
+	if !errors.Is(err, superdog.ErrProviderUnavailable) {
+		return nil, err
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if p, ok := c.c.Prefixes[prefix]; ok {
+		if e, ok := p.Salts[version]; ok && c.fresh(e.Fetched) {
+			return append([]byte(nil), e.Salt...), nil
+		}
+	}
+	return nil, err
+}
+
+// CurrentSalts returns the active salt versions from the provider, or the recorded ones if the provider is unavailable.
+func (c *Cache) CurrentSalts(prefix string) ([]uint64, error) {
+	salts, err := c.upstream.CurrentSalts(prefix)
+	if err == nil {
+		c.update(prefix, func(p *entries) bool {
+			old := p.ActiveSalts
+			if old != nil && equalVersions(old.Salts, salts) && !c.due(old.Fetched) {
+				return false
+			}
+			p.ActiveSalts = &current{Salts: append([]uint64(nil), salts...), Fetched: time.Now()}
+			return true
+		})
+		return salts, nil
+	}
+	if !errors.Is(err, superdog.ErrProviderUnavailable) {
+		return nil, err
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if p, ok := c.c.Prefixes[prefix]; ok && p.ActiveSalts != nil && c.fresh(p.ActiveSalts.Fetched) {
+		return append([]uint64(nil), p.ActiveSalts.Salts...), nil
+	}
+	return nil, err
+}
+
+// CurrentSaltVersion returns the current salt version from the provider, or the recorded one if the provider is unavailable.
+func (c *Cache) CurrentSaltVersion(prefix string) (uint64, error) {
+	v, err := c.upstream.CurrentSaltVersion(prefix)
+	if err == nil {
+		c.update(prefix, func(p *entries) bool {
+			old := p.CurrentSalt
+			if old != nil && old.Version == v && !c.due(old.Fetched) {
+				return false
+			}
+			p.CurrentSalt = &current{Version: v, Fetched: time.Now()}
+			return true
+		})
+		return v, nil
+	}
+	if !errors.Is(err, superdog.ErrProviderUnavailable) {
+		return 0, err
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if p, ok := c.c.Prefixes[prefix]; ok && p.CurrentSalt != nil && c.fresh(p.CurrentSalt.Fetched) {
+		return p.CurrentSalt.Version, nil
+	}
+	return 0, err
+}
+
+// confirmed reports whether k was recorded for version recently, so it need not be recorded again.
+func (c *Cache) confirmed(prefix string, version uint64, k *superdog.Key) bool {
+	c.l.RLock()
+	defer c.l.RUnlock()
+
+	p, ok := c.c.Prefixes[prefix]
+	if !ok {
+		return false
+	}
+	e, ok := p.Keys[version]
+	return ok && e.key == k && !c.due(e.Fetched)
+}
+
+// due reports whether an entry fetched at fetched and returned again by the provider should have its fetch time
+// updated and written. Entries are confirmed every confirmInterval, or more often for a short maxAge, so the copy on
+// disk stays fresh for a restarted process.
+func (c *Cache) due(fetched time.Time) bool {
+	within := confirmInterval
+	if c.maxAge > 0 && c.maxAge/2 < within {
+		within = c.maxAge / 2
+	}
+	return time.Since(fetched) >= within
+}
+
+// recordKey records k as version, and reports whether that changed the recorded entry or confirmed it, as decided by
+// due.
+func (p *entries) recordKey(version uint64, k *superdog.Key, due func(fetched time.Time) bool) bool {
+	e := &keyEntry{
+		Cipher:    k.Cipher.String(),
+		BlockMode: k.CipherBlockMode.String(),
+		Key:       k.Bytes(),
+		Created:   k.Created,
+		NotBefore: k.NotBefore,
+		ExpiresAt: k.ExpiresAt,
+		State:     k.State.String(),
+		Fetched:   time.Now(),
+		key:       k,
+	}
+	old := p.Keys[version]
+	if old != nil && old.Cipher == e.Cipher && old.BlockMode == e.BlockMode && bytes.Equal(old.Key, e.Key) &&
+		old.State == e.State && old.NotBefore.Equal(e.NotBefore) && old.ExpiresAt.Equal(e.ExpiresAt) {
+		superdog.Wipe(e.Key)
+		old.key = k
+		if !due(old.Fetched) {
+			return false
+		}
+		old.Fetched = e.Fetched
+		return true
+	}
+	if old != nil {
+		superdog.Wipe(old.Key)
+	}
+	p.Keys[version] = e
+	return true
+}
+
+// Flush writes the recorded entries.
+func (c *Cache) Flush() error {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	return c.save()
+}
+
+func (c *Cache) fresh(fetched time.Time) bool {
+	return c.maxAge <= 0 || time.Since(fetched) < c.maxAge
+}
+
+// update applies fn to the recorded entries for name, and saves the file if fn reports a change or confirmation.
+func (c *Cache) update(name string, fn func(p *entries) bool) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	p, ok := c.c.Prefixes[name]
+	if !ok {
+		p = &entries{}
+		c.c.Prefixes[name] = p
+	}
+	if p.Keys == nil {
+		p.Keys = make(map[uint64]*keyEntry)
+	}
+	if p.Salts == nil {
+		p.Salts = make(map[uint64]*saltEntry)
+	}
+
+	if !fn(p) {
+		return
+	}
+
+	if err := c.save(); err != nil && c.OnError != nil {
+		c.OnError(err)
+	}
+}
+
+// save seals and writes the recorded entries. The caller must hold c.l.
+func (c *Cache) save() error {
+	plain, err := json.Marshal(c.c)
+	if err != nil {
+		return err
+	}
+	b, err := seal(plain, c.secret)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	// the data must be on disk before the rename, or a crash can leave a truncated cache in place
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), c.path); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func equalVersions(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,253 @@
+package diskcache
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xordataexchange/superdog"
+	"github.com/xordataexchange/superdog/vault"
+	"github.com/xordataexchange/superdog/vault/keyring"
+)
+
+var errDown = &superdog.Error{Err: superdog.ErrProviderUnavailable, Cause: errors.New("provider unreachable")}
+
+// flaky is a provider that can be switched off.
+type flaky struct {
+	vault.Vault
+	down bool
+}
+
+func (f *flaky) GetKey(prefix string, version uint64) (*superdog.Key, error) {
+	if f.down {
+		return nil, errDown
+	}
+	return f.Vault.GetKey(prefix, version)
+}
+
+func (f *flaky) CurrentKeyVersion(prefix string) (uint64, error) {
+	if f.down {
+		return 0, errDown
+	}
+	return f.Vault.CurrentKeyVersion(prefix)
+}
+
+func (f *flaky) GetSalt(prefix string, version uint64) ([]byte, error) {
+	if f.down {
+		return nil, errDown
+	}
+	return f.Vault.GetSalt(prefix, version)
+}
+
+func (f *flaky) CurrentSalts(prefix string) ([]uint64, error) {
+	if f.down {
+		return nil, errDown
+	}
+	return f.Vault.CurrentSalts(prefix)
+}
+
+func (f *flaky) CurrentSaltVersion(prefix string) (uint64, error) {
+	if f.down {
+		return 0, errDown
+	}
+	return f.Vault.CurrentSaltVersion(prefix)
+}
+
+func upstream() *flaky {
+	k := keyring.New()
+	k.GenerateKey("ssn", superdog.AES, superdog.GCM, 32)
+	k.AddSalt("ssn", []byte("pepper"))
+	return &flaky{Vault: k}
+}
+
+func TestCacheServesWhenUpstreamFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	secret := []byte("instance secret")
+	up := upstream()
+
+	c, err := New(up, path, secret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig, _ := c.GetKey("ssn", 1)
+	c.CurrentKeyVersion("ssn")
+	c.GetSalt("ssn", 1)
+	c.CurrentSalts("ssn")
+	c.CurrentSaltVersion("ssn")
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("pepper")) || bytes.Contains(b, orig.Bytes()) {
+		t.Fatal("Expected cache file to be sealed")
+	}
+
+	// a restarted process while the provider is down
+	up.down = true
+	c, err = New(up, path, secret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := c.GetKey("ssn", 1)
+	if err != nil {
+		t.Fatal("Expected cached key", err)
+	}
+	if !bytes.Equal(k.Bytes(), orig.Bytes()) || k.CipherBlockMode != superdog.GCM {
+		t.Fatal("Expected cached key to match")
+	}
+	if v, err := c.CurrentKeyVersion("ssn"); err != nil || v != 1 {
+		t.Fatal("Expected cached current key version", v, err)
+	}
+	if s, err := c.GetSalt("ssn", 1); err != nil || !bytes.Equal(s, []byte("pepper")) {
+		t.Fatal("Expected cached salt", err)
+	}
+	if salts, err := c.CurrentSalts("ssn"); err != nil || len(salts) != 1 {
+		t.Fatal("Expected cached salts", salts, err)
+	}
+	if v, err := c.CurrentSaltVersion("ssn"); err != nil || v != 1 {
+		t.Fatal("Expected cached current salt version", v, err)
+	}
+	if _, err := c.GetKey("ssn", 2); err != errDown {
+		t.Fatal("Expected provider error for an uncached version, got", err)
+	}
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	up := upstream()
+
+	c, err := New(up, path, []byte("secret"), time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.GetKey("ssn", 1)
+
+	time.Sleep(5 * time.Millisecond)
+	up.down = true
+	if _, err := c.GetKey("ssn", 1); err != errDown {
+		t.Fatal("Expected expired entry not to be served, got", err)
+	}
+}
+
+func TestCacheRestartAfterConfirmation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	up := upstream()
+
+	c, err := New(up, path, []byte("secret"), 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.GetKey("ssn", 1)
+	c.CurrentKeyVersion("ssn")
+	c.GetSalt("ssn", 1)
+	c.CurrentSalts("ssn")
+	c.CurrentSaltVersion("ssn")
+
+	// confirmed by the provider long after the first fetch, shortly before a restart
+	time.Sleep(150 * time.Millisecond)
+	c.GetKey("ssn", 1)
+	c.CurrentKeyVersion("ssn")
+	c.GetSalt("ssn", 1)
+	c.CurrentSalts("ssn")
+	c.CurrentSaltVersion("ssn")
+	time.Sleep(100 * time.Millisecond)
+
+	up.down = true
+	c, err = New(up, path, []byte("secret"), 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetKey("ssn", 1); err != nil {
+		t.Fatal("Expected confirmed key to be served after a restart", err)
+	}
+	if _, err := c.CurrentKeyVersion("ssn"); err != nil {
+		t.Fatal("Expected confirmed current key version to be served after a restart", err)
+	}
+	if _, err := c.GetSalt("ssn", 1); err != nil {
+		t.Fatal("Expected confirmed salt to be served after a restart", err)
+	}
+	if _, err := c.CurrentSalts("ssn"); err != nil {
+		t.Fatal("Expected confirmed salts to be served after a restart", err)
+	}
+	if _, err := c.CurrentSaltVersion("ssn"); err != nil {
+		t.Fatal("Expected confirmed current salt version to be served after a restart", err)
+	}
+}
+
+func TestCacheNotFoundPassesThrough(t *testing.T) {
+	up := upstream()
+	c, err := New(up, filepath.Join(t.TempDir(), "cache"), []byte("secret"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.GetKey("ssn", 5); err != superdog.ErrKeyNotFound {
+		t.Fatal("Expected key not found error, got", err)
+	}
+}
+
+func TestCacheWritesOnlyChanges(t *testing.T) {
+	up := upstream()
+	path := filepath.Join(t.TempDir(), "cache")
+	c, err := New(up, path, []byte("secret"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.GetKey("ssn", 1)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal("Expected new key to be written", err)
+	}
+	os.Remove(path)
+	c.GetKey("ssn", 1)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("Expected unchanged key not to be written again", err)
+	}
+}
+
+// denied is a provider refusing every key request.
+type denied struct {
+	vault.Vault
+}
+
+func (denied) GetKey(prefix string, version uint64) (*superdog.Key, error) {
+	return nil, errors.New("permission denied")
+}
+
+func TestCacheOtherErrorsPassThrough(t *testing.T) {
+	up := upstream()
+	c, err := New(up, filepath.Join(t.TempDir(), "cache"), []byte("secret"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetKey("ssn", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	c.upstream = denied{up}
+	if _, err := c.GetKey("ssn", 1); err == nil || err.Error() != "permission denied" {
+		t.Fatal("Expected a denied request not to be answered from the cache, got", err)
+	}
+}
+
+func TestCacheWrongSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	up := upstream()
+
+	c, _ := New(up, path, []byte("one"), 0)
+	c.GetKey("ssn", 1)
+
+	up.down = true
+	c, err := New(up, path, []byte("two"), 0)
+	if err != nil {
+		t.Fatal("Expected unreadable cache to be ignored", err)
+	}
+	if _, err := c.GetKey("ssn", 1); err != errDown {
+		t.Fatal("Expected provider error, got", err)
+	}
+}
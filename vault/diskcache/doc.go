@@ -0,0 +1,11 @@
+/*
+See LICENSE file for license details
+Copyright (c) 2015 XOR Data Exchange, Inc.
+
+
+Package diskcache provides a decorator for any vault implementation that keeps the keys and salts it fetches in an
+encrypted local file, so a restarted process can still decrypt while its provider is unreachable.
+The file is sealed with a key derived from a secret supplied by the caller, which should be kept from other users of
+the host, and is only read when the provider is unavailable.
+*/
+package diskcache
@@ -0,0 +1,75 @@
+package diskcache
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// info binds derived keys to this use, so the same machine secret used elsewhere yields a different key.
+const info = "superdog diskcache v1"
+
+// ErrUnseal is returned when the cache file was sealed with a different secret or has been modified.
+var ErrUnseal = errors.New("Disk cache could not be unsealed")
+
+// seal encrypts plain with AES-256-GCM under a key derived from secret. The result is a random HKDF salt,
+// followed by the GCM nonce and ciphertext.
+func seal(plain, secret []byte) ([]byte, error) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := deriveAEAD(secret, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	out := append(salt, nonce...)
+	return aead.Seal(out, nonce, plain, nil), nil
+}
+
+func unseal(b, secret []byte) ([]byte, error) {
+	if len(b) < 16 {
+		return nil, ErrUnseal
+	}
+
+	aead, err := deriveAEAD(secret, b[:16])
+	if err != nil {
+		return nil, err
+	}
+
+	b = b[16:]
+	if len(b) < aead.NonceSize() {
+		return nil, ErrUnseal
+	}
+
+	plain, err := aead.Open(nil, b[:aead.NonceSize()], b[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrUnseal
+	}
+	return plain, nil
+}
+
+func deriveAEAD(secret, salt []byte) (cipher.AEAD, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), key); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,23 @@
+/*
+See LICENSE file for license details
+Copyright (c) 2015 XOR Data Exchange, Inc.
+
+
+Package env provides an implementation of the vault interface that reads keys and salts from environment variables,
+for deployments where the platform injects secrets into the process environment.
+
+Keys are read from variables of the form
+
+	SUPERDOG_KEY_<PREFIX>_<VERSION>=<cipher>:<block mode>:<base64 key>
+	SUPERDOG_KEY_<PREFIX>_CURRENT=<version>
+
+and salts from
+
+	SUPERDOG_SALT_<PREFIX>_<VERSION>=<base64 salt>
+	SUPERDOG_SALT_<PREFIX>_CURRENT=<version>
+
+<PREFIX> is the key prefix in upper case, with every character other than a letter or digit replaced by an underscore,
+so the prefix "fields/ssn" is read from SUPERDOG_KEY_FIELDS_SSN_1 and so on. The <PREFIX> and CURRENT parts of a
+name are matched in any case, so SUPERDOG_KEY_fields_ssn_1 is read for the same prefix.
+*/
+package env
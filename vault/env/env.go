@@ -0,0 +1,235 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xordataexchange/superdog"
+	"github.com/xordataexchange/superdog/vault"
+)
+
+// Variable name prefixes.
+const (
+	KeyVarPrefix  = "SUPERDOG_KEY_"
+	SaltVarPrefix = "SUPERDOG_SALT_"
+)
+
+var _ vault.Vault = &Provider{}
+
+// Provider serves keys and salts parsed from the environment. All values are validated when it is created,
+// and it never changes afterwards.
+type Provider struct {
+	keys  map[string]*keySet
+	salts map[string]*saltSet
+}
+
+type keySet struct {
+	current  uint64
+	versions map[uint64]*superdog.Key
+}
+
+type saltSet struct {
+	current  uint64
+	versions map[uint64][]byte
+}
+
+// New returns a Provider for the keys and salts in the process environment.
+func New() (*Provider, error) {
+	return Parse(os.Environ())
+}
+
+// Parse returns a Provider for the keys and salts in environ, a list of "NAME=value" strings as returned by os.Environ.
+// It fails if any key or salt variable is malformed, or a prefix's current version is missing.
+func Parse(environ []string) (*Provider, error) {
+	p := &Provider{
+		keys:  make(map[string]*keySet),
+		salts: make(map[string]*saltSet),
+	}
+
+	for _, kv := range environ {
+		i := strings.IndexByte(kv, '=')
+		if i < 0 {
+			continue
+		}
+		name, value := kv[:i], kv[i+1:]
+
+		var err error
+		switch {
+		case strings.HasPrefix(name, KeyVarPrefix):
+			err = p.parseKey(name, strings.TrimPrefix(name, KeyVarPrefix), value)
+		case strings.HasPrefix(name, SaltVarPrefix):
+			err = p.parseSalt(name, strings.TrimPrefix(name, SaltVarPrefix), value)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for prefix, ks := range p.keys {
+		if ks.current == 0 {
+			return nil, fmt.Errorf("%s%s_CURRENT is not set", KeyVarPrefix, prefix)
+		}
+		if _, ok := ks.versions[ks.current]; !ok {
+			return nil, fmt.Errorf("%s%s_CURRENT refers to missing version %d", KeyVarPrefix, prefix, ks.current)
+		}
+	}
+	for prefix, ss := range p.salts {
+		if ss.current == 0 {
+			return nil, fmt.Errorf("%s%s_CURRENT is not set", SaltVarPrefix, prefix)
+		}
+		if _, ok := ss.versions[ss.current]; !ok {
+			return nil, fmt.Errorf("%s%s_CURRENT refers to missing version %d", SaltVarPrefix, prefix, ss.current)
+		}
+	}
+
+	return p, nil
+}
+
+func (p *Provider) parseKey(name, suffix, value string) error {
+	prefix, version, current, err := splitName(name, suffix)
+	if err != nil {
+		return err
+	}
+
+	ks, ok := p.keys[prefix]
+	if !ok {
+		ks = &keySet{versions: make(map[uint64]*superdog.Key)}
+		p.keys[prefix] = ks
+	}
+
+	if current {
+		ks.current, err = strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: invalid version: %s", name, err)
+		}
+		return nil
+	}
+
+	ks.versions[version], err = vault.ParseKeySpec(version, value)
+	if err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+	return nil
+}
+
+func (p *Provider) parseSalt(name, suffix, value string) error {
+	prefix, version, current, err := splitName(name, suffix)
+	if err != nil {
+		return err
+	}
+
+	ss, ok := p.salts[prefix]
+	if !ok {
+		ss = &saltSet{versions: make(map[uint64][]byte)}
+		p.salts[prefix] = ss
+	}
+
+	if current {
+		ss.current, err = strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: invalid version: %s", name, err)
+		}
+		return nil
+	}
+
+	ss.versions[version], err = vault.DecodeBase64(value)
+	if err != nil {
+		return fmt.Errorf("%s: invalid salt: %s", name, err)
+	}
+	return nil
+}
+
+// splitName splits the part of a variable name after SUPERDOG_KEY_ or SUPERDOG_SALT_ into the prefix, normalized with
+// VarName as lookups are, and either a version or CURRENT.
+func splitName(name, suffix string) (prefix string, version uint64, current bool, err error) {
+	i := strings.LastIndexByte(suffix, '_')
+	if i <= 0 {
+		return "", 0, false, fmt.Errorf("%s: expected <PREFIX>_<VERSION> or <PREFIX>_CURRENT", name)
+	}
+
+	prefix = VarName(suffix[:i])
+	if strings.EqualFold(suffix[i+1:], "CURRENT") {
+		return prefix, 0, true, nil
+	}
+
+	version, err = strconv.ParseUint(suffix[i+1:], 10, 64)
+	if err != nil || version == 0 {
+		return "", 0, false, fmt.Errorf("%s: invalid version %q", name, suffix[i+1:])
+	}
+	return prefix, version, false, nil
+}
+
+// VarName returns the part of a variable name that identifies prefix, e.g. "FIELDS_SSN" for "fields/ssn".
+func VarName(prefix string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, prefix)
+}
+
+// GetKey returns the key for prefix at version.
+func (p *Provider) GetKey(prefix string, version uint64) (*superdog.Key, error) {
+	ks, ok := p.keys[VarName(prefix)]
+	if !ok {
+		return nil, superdog.ErrKeyNotFound
+	}
+	k, ok := ks.versions[version]
+	if !ok {
+		return nil, superdog.ErrKeyNotFound
+	}
+	return k, nil
+}
+
+// CurrentKeyVersion returns the version set in SUPERDOG_KEY_<PREFIX>_CURRENT.
+func (p *Provider) CurrentKeyVersion(prefix string) (uint64, error) {
+	ks, ok := p.keys[VarName(prefix)]
+	if !ok {
+		return 0, superdog.ErrKeyNotFound
+	}
+	return ks.current, nil
+}
+
+// GetSalt returns the salt for prefix at version.
+func (p *Provider) GetSalt(prefix string, version uint64) ([]byte, error) {
+	ss, ok := p.salts[VarName(prefix)]
+	if !ok {
+		return nil, superdog.ErrSaltNotFound
+	}
+	s, ok := ss.versions[version]
+	if !ok {
+		return nil, superdog.ErrSaltNotFound
+	}
+	return append([]byte(nil), s...), nil
+}
+
+// CurrentSalts returns every salt version set for prefix, in ascending order.
+func (p *Provider) CurrentSalts(prefix string) ([]uint64, error) {
+	ss, ok := p.salts[VarName(prefix)]
+	if !ok {
+		return nil, superdog.ErrSaltNotFound
+	}
+
+	salts := make([]uint64, 0, len(ss.versions))
+	for v := range ss.versions {
+		salts = append(salts, v)
+	}
+	sort.Slice(salts, func(i, j int) bool { return salts[i] < salts[j] })
+	return salts, nil
+}
+
+// CurrentSaltVersion returns the version set in SUPERDOG_SALT_<PREFIX>_CURRENT.
+func (p *Provider) CurrentSaltVersion(prefix string) (uint64, error) {
+	ss, ok := p.salts[VarName(prefix)]
+	if !ok {
+		return 0, superdog.ErrSaltNotFound
+	}
+	return ss.current, nil
+}
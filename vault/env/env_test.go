@@ -0,0 +1,107 @@
+package env
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/xordataexchange/superdog"
+)
+
+var environ = []string{
+	"PATH=/usr/bin",
+	"SUPERDOG_KEY_FIELDS_SSN_1=AES:CFB:REVGQVVMVCBYT1IgS0VZIERFRkFVTFQgWE9SIEtFWSA=",
+	"SUPERDOG_KEY_FIELDS_SSN_2=AES:GCM:REVGQVVMVCBYT1IgS0VZIERFRkFVTFQgWE9SIEtFWTI=",
+	"SUPERDOG_KEY_FIELDS_SSN_CURRENT=2",
+	"SUPERDOG_SALT_FIELDS_SSN_1=QUJDMTIz",
+	"SUPERDOG_SALT_FIELDS_SSN_3=REVGNDU2",
+	"SUPERDOG_SALT_FIELDS_SSN_CURRENT=3",
+}
+
+func TestParse(t *testing.T) {
+	p, err := Parse(environ)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := p.CurrentKeyVersion("fields/ssn")
+	if err != nil || version != 2 {
+		t.Fatal("Expected current key version to be 2", version, err)
+	}
+
+	k, err := p.GetKey("fields/ssn", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Version != 1 || k.Cipher != superdog.AES || k.CipherBlockMode != superdog.CFB {
+		t.Fatal("Key returned is invalid")
+	}
+
+	if _, err := p.GetKey("fields/ssn", 3); err != superdog.ErrKeyNotFound {
+		t.Fatal("Expected key not found error, got", err)
+	}
+
+	salts, err := p.CurrentSalts("fields/ssn")
+	if err != nil || len(salts) != 2 || salts[0] != 1 || salts[1] != 3 {
+		t.Fatal("Expected salts 1 and 3", salts, err)
+	}
+
+	s, err := p.GetSalt("fields/ssn", 1)
+	if err != nil || !bytes.Equal(s, []byte("ABC123")) {
+		t.Fatal("Salt returned does not match.", err)
+	}
+
+	s[0] = 'X'
+	if s, _ := p.GetSalt("fields/ssn", 1); !bytes.Equal(s, []byte("ABC123")) {
+		t.Fatal("Expected GetSalt to return a copy")
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := map[string][]string{
+		"missing current":  {"SUPERDOG_KEY_SSN_1=AES:GCM:REVGQVVMVCBYT1IgS0VZIERFRkFVTFQgWE9SIEtFWTI="},
+		"current missing":  {"SUPERDOG_KEY_SSN_1=AES:GCM:REVGQVVMVCBYT1IgS0VZIERFRkFVTFQgWE9SIEtFWTI=", "SUPERDOG_KEY_SSN_CURRENT=2"},
+		"bad key length":   {"SUPERDOG_KEY_SSN_1=AES:GCM:QUJD", "SUPERDOG_KEY_SSN_CURRENT=1"},
+		"bad block mode":   {"SUPERDOG_KEY_SSN_1=AES:ECB:REVGQVVMVCBYT1IgS0VZIERFRkFVTFQgWE9SIEtFWTI=", "SUPERDOG_KEY_SSN_CURRENT=1"},
+		"missing spec":     {"SUPERDOG_KEY_SSN_1=REVGQVVMVCBYT1IgS0VZIERFRkFVTFQgWE9SIEtFWTI=", "SUPERDOG_KEY_SSN_CURRENT=1"},
+		"bad version":      {"SUPERDOG_SALT_SSN_X=QUJD", "SUPERDOG_SALT_SSN_CURRENT=1"},
+		"bad salt":         {"SUPERDOG_SALT_SSN_1=!!!", "SUPERDOG_SALT_SSN_CURRENT=1"},
+		"salt current nan": {"SUPERDOG_SALT_SSN_1=QUJD", "SUPERDOG_SALT_SSN_CURRENT=latest"},
+	}
+
+	for name, environ := range tests {
+		if _, err := Parse(environ); err == nil {
+			t.Error("Expected error for", name)
+		} else if !strings.Contains(err.Error(), "SUPERDOG_") {
+			t.Error("Expected error to name the variable for", name, err)
+		}
+	}
+}
+
+func TestVarName(t *testing.T) {
+	if n := VarName("fields/ssn-2"); n != "FIELDS_SSN_2" {
+		t.Fatal("Unexpected variable name", n)
+	}
+}
+
+func TestParseLowercase(t *testing.T) {
+	p, err := Parse([]string{
+		"SUPERDOG_KEY_fields_ssn_1=AES:GCM:REVGQVVMVCBYT1IgS0VZIERFRkFVTFQgWE9SIEtFWTI=",
+		"SUPERDOG_KEY_Fields_Ssn_current=1",
+		"SUPERDOG_SALT_fields_ssn_1=QUJDMTIz",
+		"SUPERDOG_SALT_FIELDS_SSN_CURRENT=1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version, err := p.CurrentKeyVersion("fields/ssn"); err != nil || version != 1 {
+		t.Fatal("Expected current key version 1", version, err)
+	}
+	if _, err := p.GetKey("fields/ssn", 1); err != nil {
+		t.Fatal("Expected lowercase key variable to be found", err)
+	}
+	if s, err := p.GetSalt("fields/ssn", 1); err != nil || !bytes.Equal(s, []byte("ABC123")) {
+		t.Fatal("Expected lowercase salt variable to be found", err)
+	}
+}
@@ -0,0 +1,18 @@
+/*
+See LICENSE file for license details
+Copyright (c) 2015 XOR Data Exchange, Inc.
+
+
+Package files provides an implementation of the vault interface that reads keys and salts from a directory of files,
+such as a Kubernetes secret volume, and picks up changes while the process is running.
+
+Keys are read from a key directory laid out as
+
+	<dir>/<prefix>/<version>   <cipher>:<block mode>:<base64 key>, e.g. AES:GCM:c2VjcmV0...
+	<dir>/<prefix>/current     the version to encrypt with
+
+and salts from a salt directory laid out the same way, with each version file holding a base64 salt.
+Prefixes containing slashes map to nested directories. Names starting with ".." are ignored, so the hidden
+directories Kubernetes uses for atomic updates are skipped.
+*/
+package files
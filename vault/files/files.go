@@ -0,0 +1,446 @@
+package files
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xordataexchange/superdog"
+	"github.com/xordataexchange/superdog/vault"
+)
+
+var _ vault.Vault = &Provider{}
+
+// Provider serves keys and salts read from a key directory and a salt directory.
+// Versions are never dropped once loaded, so ciphertext written with a key removed from disk can still be decrypted
+// until the process restarts, and never change: a reload that finds a loaded version with other contents fails.
+type Provider struct {
+	// OnReload is called after changed files have been loaded.
+	OnReload func()
+	// OnReloadError is called when the directories could not be read or contain invalid files. The previous contents
+	// stay in use.
+	OnReloadError func(err error)
+
+	keyDir  string
+	saltDir string
+
+	l     sync.RWMutex
+	keys  map[string]*keySet
+	salts map[string]*saltSet
+	sums  map[string]sum // file hashes of the last load, to detect changes
+
+	done    chan struct{}
+	closed  sync.Once
+	watched sync.Once
+	wg      sync.WaitGroup
+}
+
+// sum is the SHA-256 hash of a file.
+type sum [sha256.Size]byte
+
+type keySet struct {
+	current  uint64
+	versions map[uint64]*superdog.Key
+	sums     map[uint64]sum
+}
+
+type saltSet struct {
+	current  uint64
+	versions map[uint64][]byte
+	sums     map[uint64]sum
+}
+
+// New returns a Provider for the files in keyDir and saltDir. Either may be empty if it is not used.
+// All files are read and validated before New returns.
+func New(keyDir, saltDir string) (*Provider, error) {
+	p := &Provider{
+		keyDir:  keyDir,
+		saltDir: saltDir,
+		keys:    make(map[string]*keySet),
+		salts:   make(map[string]*saltSet),
+		done:    make(chan struct{}),
+	}
+
+	if _, err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Watch checks the directories for changes every interval until Close is called. Only the first call starts watching.
+func (p *Provider) Watch(interval time.Duration) {
+	p.watched.Do(func() {
+		p.wg.Add(1)
+		go p.watch(interval)
+	})
+}
+
+func (p *Provider) watch(interval time.Duration) {
+	defer p.wg.Done()
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-t.C:
+			changed, err := p.Reload()
+			if err != nil {
+				if p.OnReloadError != nil {
+					p.OnReloadError(err)
+				}
+				continue
+			}
+			if changed && p.OnReload != nil {
+				p.OnReload()
+			}
+		}
+	}
+}
+
+// Close stops watching the directories, and waits for a reload in progress to finish.
+func (p *Provider) Close() error {
+	p.closed.Do(func() {
+		close(p.done)
+	})
+	p.wg.Wait()
+	return nil
+}
+
+// Reload reads the directories and, if anything changed, swaps in the new current versions and adds any new versions.
+// It reports whether anything changed. On error, including a loaded version whose file now holds another key or
+// salt, nothing is changed.
+func (p *Provider) Reload() (bool, error) {
+	raw := make(map[string][]byte)
+	defer func() {
+		for _, b := range raw {
+			superdog.Wipe(b)
+		}
+	}()
+	if err := readTree(p.keyDir, "keys", raw); err != nil {
+		return false, err
+	}
+	if err := readTree(p.saltDir, "salts", raw); err != nil {
+		return false, err
+	}
+
+	sums := make(map[string]sum, len(raw))
+	for name, b := range raw {
+		sums[name] = sha256.Sum256(b)
+	}
+
+	p.l.RLock()
+	same := p.sums != nil && equal(p.sums, sums)
+	p.l.RUnlock()
+	if same {
+		return false, nil
+	}
+
+	keys, salts, err := parse(raw)
+	if err != nil {
+		return false, err
+	}
+
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	if err := merge(keys, salts, p.keys, p.salts); err != nil {
+		destroy(keys)
+		return false, err
+	}
+	p.keys, p.salts, p.sums = keys, salts, sums
+	return true, nil
+}
+
+// merge adds every version already loaded to the newly parsed keys and salts, as existing ciphertext may still need
+// it. Versions whose files are unchanged keep the loaded key, so keys already returned keep working, and the parsed
+// copy is destroyed. A version whose file changed is an error, as ciphertext written with the loaded key would no
+// longer decrypt; keys is then left as parsed.
+func merge(keys map[string]*keySet, salts map[string]*saltSet, oldKeys map[string]*keySet, oldSalts map[string]*saltSet) error {
+	for prefix, old := range oldKeys {
+		if ks, ok := keys[prefix]; ok {
+			for v := range old.versions {
+				if s, ok := ks.sums[v]; ok && s != old.sums[v] {
+					return fmt.Errorf("keys/%s/%d: loaded version changed", prefix, v)
+				}
+			}
+		}
+	}
+	for prefix, old := range oldSalts {
+		if ss, ok := salts[prefix]; ok {
+			for v := range old.versions {
+				if s, ok := ss.sums[v]; ok && s != old.sums[v] {
+					return fmt.Errorf("salts/%s/%d: loaded version changed", prefix, v)
+				}
+			}
+		}
+	}
+
+	for prefix, old := range oldKeys {
+		ks, ok := keys[prefix]
+		if !ok {
+			keys[prefix] = old
+			continue
+		}
+		for v, k := range old.versions {
+			if parsed, ok := ks.versions[v]; ok {
+				parsed.Destroy()
+			}
+			ks.versions[v], ks.sums[v] = k, old.sums[v]
+		}
+	}
+	for prefix, old := range oldSalts {
+		ss, ok := salts[prefix]
+		if !ok {
+			salts[prefix] = old
+			continue
+		}
+		for v, s := range old.versions {
+			ss.versions[v], ss.sums[v] = s, old.sums[v]
+		}
+	}
+	return nil
+}
+
+// destroy destroys every key in keys.
+func destroy(keys map[string]*keySet) {
+	for _, ks := range keys {
+		for _, k := range ks.versions {
+			k.Destroy()
+		}
+	}
+}
+
+// readTree reads every regular file below dir into raw, keyed by kind and the slash separated path relative to dir.
+func readTree(dir, kind string, raw map[string][]byte) error {
+	if dir == "" {
+		return nil
+	}
+
+	var walk func(rel string) error
+	walk = func(rel string) error {
+		entries, err := os.ReadDir(filepath.Join(dir, filepath.FromSlash(rel)))
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), "..") {
+				continue
+			}
+
+			name := path.Join(rel, e.Name())
+			full := filepath.Join(dir, filepath.FromSlash(name))
+
+			// Stat rather than the directory entry, to follow symlinks
+			fi, err := os.Stat(full)
+			if err != nil {
+				return err
+			}
+			if fi.IsDir() {
+				if err := walk(name); err != nil {
+					return err
+				}
+				continue
+			}
+
+			b, err := os.ReadFile(full)
+			if err != nil {
+				return err
+			}
+			raw[kind+"/"+name] = b
+		}
+		return nil
+	}
+
+	return walk("")
+}
+
+// parse builds key and salt sets from the file contents read by readTree.
+func parse(raw map[string][]byte) (map[string]*keySet, map[string]*saltSet, error) {
+	keys := make(map[string]*keySet)
+	salts := make(map[string]*saltSet)
+
+	for name, b := range raw {
+		kind, rel, _ := strings.Cut(name, "/")
+		prefix, file := path.Split(rel)
+		prefix = strings.TrimSuffix(prefix, "/")
+		if prefix == "" {
+			continue
+		}
+
+		var version uint64
+		current := file == "current"
+		if current {
+			v, err := strconv.ParseUint(string(bytes.TrimSpace(b)), 10, 64)
+			if err != nil {
+				destroy(keys)
+				return nil, nil, fmt.Errorf("%s: invalid version: %s", rel, err)
+			}
+			version = v
+		} else {
+			v, err := strconv.ParseUint(file, 10, 64)
+			if err != nil {
+				// not a version file
+				continue
+			}
+			version = v
+		}
+
+		switch kind {
+		case "keys":
+			ks, ok := keys[prefix]
+			if !ok {
+				ks = &keySet{versions: make(map[uint64]*superdog.Key), sums: make(map[uint64]sum)}
+				keys[prefix] = ks
+			}
+			if current {
+				ks.current = version
+				continue
+			}
+
+			k, err := vault.ParseKeySpec(version, string(b))
+			if err != nil {
+				destroy(keys)
+				return nil, nil, fmt.Errorf("%s: %s", rel, err)
+			}
+			ks.versions[version], ks.sums[version] = k, sha256.Sum256(b)
+		case "salts":
+			ss, ok := salts[prefix]
+			if !ok {
+				ss = &saltSet{versions: make(map[uint64][]byte), sums: make(map[uint64]sum)}
+				salts[prefix] = ss
+			}
+			if current {
+				ss.current = version
+				continue
+			}
+
+			s, err := vault.DecodeBase64(string(b))
+			if err != nil {
+				destroy(keys)
+				return nil, nil, fmt.Errorf("%s: invalid salt: %s", rel, err)
+			}
+			ss.versions[version], ss.sums[version] = s, sha256.Sum256(b)
+		}
+	}
+
+	for prefix, ks := range keys {
+		if ks.current == 0 {
+			destroy(keys)
+			return nil, nil, fmt.Errorf("keys/%s: missing current file", prefix)
+		}
+		if _, ok := ks.versions[ks.current]; !ok {
+			destroy(keys)
+			return nil, nil, fmt.Errorf("keys/%s: current version %d not found", prefix, ks.current)
+		}
+	}
+	for prefix, ss := range salts {
+		if ss.current == 0 {
+			destroy(keys)
+			return nil, nil, fmt.Errorf("salts/%s: missing current file", prefix)
+		}
+		if _, ok := ss.versions[ss.current]; !ok {
+			destroy(keys)
+			return nil, nil, fmt.Errorf("salts/%s: current version %d not found", prefix, ss.current)
+		}
+	}
+
+	return keys, salts, nil
+}
+
+func equal(a, b map[string]sum) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, v := range a {
+		if w, ok := b[name]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
+
+// GetKey returns the key for prefix at version.
+func (p *Provider) GetKey(prefix string, version uint64) (*superdog.Key, error) {
+	p.l.RLock()
+	defer p.l.RUnlock()
+
+	ks, ok := p.keys[prefix]
+	if !ok {
+		return nil, superdog.ErrKeyNotFound
+	}
+	k, ok := ks.versions[version]
+	if !ok {
+		return nil, superdog.ErrKeyNotFound
+	}
+	return k, nil
+}
+
+// CurrentKeyVersion returns the version in <dir>/<prefix>/current.
+func (p *Provider) CurrentKeyVersion(prefix string) (uint64, error) {
+	p.l.RLock()
+	defer p.l.RUnlock()
+
+	ks, ok := p.keys[prefix]
+	if !ok {
+		return 0, superdog.ErrKeyNotFound
+	}
+	return ks.current, nil
+}
+
+// GetSalt returns the salt for prefix at version.
+func (p *Provider) GetSalt(prefix string, version uint64) ([]byte, error) {
+	p.l.RLock()
+	defer p.l.RUnlock()
+
+	ss, ok := p.salts[prefix]
+	if !ok {
+		return nil, superdog.ErrSaltNotFound
+	}
+	s, ok := ss.versions[version]
+	if !ok {
+		return nil, superdog.ErrSaltNotFound
+	}
+	return append([]byte(nil), s...), nil
+}
+
+// CurrentSalts returns every salt version loaded for prefix, in ascending order.
+func (p *Provider) CurrentSalts(prefix string) ([]uint64, error) {
+	p.l.RLock()
+	defer p.l.RUnlock()
+
+	ss, ok := p.salts[prefix]
+	if !ok {
+		return nil, superdog.ErrSaltNotFound
+	}
+
+	salts := make([]uint64, 0, len(ss.versions))
+	for v := range ss.versions {
+		salts = append(salts, v)
+	}
+	sort.Slice(salts, func(i, j int) bool { return salts[i] < salts[j] })
+	return salts, nil
+}
+
+// CurrentSaltVersion returns the version in <dir>/<prefix>/current of the salt directory.
+func (p *Provider) CurrentSaltVersion(prefix string) (uint64, error) {
+	p.l.RLock()
+	defer p.l.RUnlock()
+
+	ss, ok := p.salts[prefix]
+	if !ok {
+		return 0, superdog.ErrSaltNotFound
+	}
+	return ss.current, nil
+}
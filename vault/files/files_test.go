@@ -0,0 +1,219 @@
+package files
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xordataexchange/superdog"
+)
+
+const (
+	key1 = "AES:CFB:REVGQVVMVCBYT1IgS0VZIERFRkFVTFQgWE9SIEtFWSA="
+	key2 = "AES:GCM:REVGQVVMVCBYT1IgS0VZIERFRkFVTFQgWE9SIEtFWTI="
+)
+
+// writeVersion writes files into a new hidden data directory and points <dir>/..data at it,
+// the way Kubernetes updates a secret volume.
+func writeVersion(t *testing.T, dir, name string, files map[string]string) {
+	data := filepath.Join(dir, name)
+	for f, content := range files {
+		p := filepath.Join(data, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tmp := filepath.Join(dir, "..data_tmp")
+	if err := os.Symlink(name, tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Lstat(filepath.Join(dir, "fields")); os.IsNotExist(err) {
+		if err := os.Symlink(filepath.Join("..data", "fields"), filepath.Join(dir, "fields")); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	keys, salts := t.TempDir(), t.TempDir()
+	writeVersion(t, keys, "..v1", map[string]string{"fields/ssn/1": key1, "fields/ssn/2": key2, "fields/ssn/current": "2\n"})
+	writeVersion(t, salts, "..v1", map[string]string{"fields/ssn/1": "QUJDMTIz", "fields/ssn/current": "1"})
+
+	p, err := New(keys, salts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := p.CurrentKeyVersion("fields/ssn")
+	if err != nil || version != 2 {
+		t.Fatal("Expected current key version to be 2", version, err)
+	}
+
+	k, err := p.GetKey("fields/ssn", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Version != 1 || k.CipherBlockMode != superdog.CFB {
+		t.Fatal("Key returned is invalid")
+	}
+
+	s, err := p.GetSalt("fields/ssn", 1)
+	if err != nil || !bytes.Equal(s, []byte("ABC123")) {
+		t.Fatal("Salt returned does not match.", err)
+	}
+
+	if _, err := p.GetKey("other", 1); err != superdog.ErrKeyNotFound {
+		t.Fatal("Expected key not found error, got", err)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	keys := t.TempDir()
+	writeVersion(t, keys, "..v1", map[string]string{"fields/ssn/1": key1, "fields/ssn/current": "2"})
+
+	if _, err := New(keys, ""); err == nil {
+		t.Fatal("Expected error for current version without a key")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	keys := t.TempDir()
+	writeVersion(t, keys, "..v1", map[string]string{"fields/ssn/1": key1, "fields/ssn/current": "1"})
+
+	p, err := New(keys, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	reloaded := make(chan struct{}, 1)
+	p.OnReload = func() {
+		select {
+		case reloaded <- struct{}{}:
+		default:
+		}
+	}
+	p.Watch(5 * time.Millisecond)
+
+	// version 1 is removed from disk as version 2 is rotated in
+	writeVersion(t, keys, "..v2", map[string]string{"fields/ssn/2": key2, "fields/ssn/current": "2"})
+
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Fatal("Expected change to be picked up")
+	}
+
+	if version, _ := p.CurrentKeyVersion("fields/ssn"); version != 2 {
+		t.Fatal("Expected current key version to be 2")
+	}
+	if _, err := p.GetKey("fields/ssn", 1); err != nil {
+		t.Fatal("Expected removed version to still be available for decryption", err)
+	}
+}
+
+func TestReloadKeepsUnchangedKeys(t *testing.T) {
+	keys := t.TempDir()
+	writeVersion(t, keys, "..v1", map[string]string{"fields/ssn/1": key1, "fields/ssn/current": "1"})
+
+	p, err := New(keys, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, _ := p.GetKey("fields/ssn", 1)
+
+	writeVersion(t, keys, "..v2", map[string]string{"fields/ssn/1": key1, "fields/ssn/2": key2, "fields/ssn/current": "2"})
+	if changed, err := p.Reload(); !changed || err != nil {
+		t.Fatal("Expected reload", changed, err)
+	}
+
+	if _, err := old.Encrypt(nil, []byte("value")); err != nil {
+		t.Fatal("Expected unchanged key to keep working", err)
+	}
+	if k, _ := p.GetKey("fields/ssn", 1); k != old {
+		t.Fatal("Expected unchanged key to be kept")
+	}
+}
+
+func TestReloadRejectsChangedVersion(t *testing.T) {
+	keys := t.TempDir()
+	writeVersion(t, keys, "..v1", map[string]string{"fields/ssn/1": key1, "fields/ssn/current": "1"})
+
+	p, err := New(keys, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, _ := p.GetKey("fields/ssn", 1)
+
+	writeVersion(t, keys, "..v2", map[string]string{"fields/ssn/1": key2, "fields/ssn/2": key2, "fields/ssn/current": "2"})
+	if _, err := p.Reload(); err == nil {
+		t.Fatal("Expected a changed version to fail the reload")
+	}
+
+	if k, _ := p.GetKey("fields/ssn", 1); k != old {
+		t.Fatal("Expected loaded key to stay in use")
+	}
+	if version, _ := p.CurrentKeyVersion("fields/ssn"); version != 1 {
+		t.Fatal("Expected previous version to stay current")
+	}
+}
+
+func TestWatchOnce(t *testing.T) {
+	keys := t.TempDir()
+	writeVersion(t, keys, "..v1", map[string]string{"fields/ssn/1": key1, "fields/ssn/current": "1"})
+
+	p, err := New(keys, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reloads atomic.Int32
+	p.OnReload = func() { reloads.Add(1) }
+	p.Watch(time.Millisecond)
+	p.Watch(time.Millisecond)
+
+	writeVersion(t, keys, "..v2", map[string]string{"fields/ssn/1": key1, "fields/ssn/2": key2, "fields/ssn/current": "2"})
+	for deadline := time.Now().Add(time.Second); reloads.Load() == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	p.Close()
+
+	if n := reloads.Load(); n != 1 {
+		t.Fatal("Expected a single watcher to pick up the change once, got", n)
+	}
+	writeVersion(t, keys, "..v3", map[string]string{"fields/ssn/1": key1, "fields/ssn/2": key2, "fields/ssn/current": "1"})
+	time.Sleep(10 * time.Millisecond)
+	if n := reloads.Load(); n != 1 {
+		t.Fatal("Expected no reloads after Close, got", n)
+	}
+}
+
+func TestReloadKeepsPreviousOnError(t *testing.T) {
+	keys := t.TempDir()
+	writeVersion(t, keys, "..v1", map[string]string{"fields/ssn/1": key1, "fields/ssn/current": "1"})
+
+	p, err := New(keys, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeVersion(t, keys, "..v2", map[string]string{"fields/ssn/2": "AES:GCM:bm90IGEga2V5", "fields/ssn/current": "2"})
+	if _, err := p.Reload(); err == nil {
+		t.Fatal("Expected invalid key to fail the reload")
+	}
+
+	if version, _ := p.CurrentKeyVersion("fields/ssn"); version != 1 {
+		t.Fatal("Expected previous version to stay current")
+	}
+}
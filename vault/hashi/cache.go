@@ -0,0 +1,210 @@
+package hashi
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/xordataexchange/superdog"
+)
+
+// metricsName is the provider name reported to the Metrics.
+const metricsName = "hashi"
+
+// metrics returns the Metrics measurements are reported to.
+func (v *Vault) metrics() superdog.Metrics {
+	if v.Metrics != nil {
+		return v.Metrics
+	}
+	return superdog.DefaultMetrics
+}
+
+// cacheLookup reports whether a lookup of op for prefix was answered from the cache.
+func (v *Vault) cacheLookup(span superdog.Span, op, prefix string, hit bool) {
+	span.SetAttribute(superdog.AttrCacheHit, hit)
+	v.metrics().CacheLookup(metricsName, op, prefix, hit)
+}
+
+// startSpan starts a span for a lookup of prefix.
+func startSpan(ctx context.Context, name, prefix string) superdog.Span {
+	_, span := superdog.DefaultTracer.Start(ctx, name)
+	span.SetAttribute(superdog.AttrPrefix, prefix)
+	return span
+}
+
+// observeRequest reports a Vault read for op that started at start.
+func (v *Vault) observeRequest(op, prefix string, start time.Time, err error) {
+	v.metrics().ProviderRequest(metricsName, op, prefix, time.Since(start), err)
+}
+
+// current is a cached answer to a "which version is current" lookup. Unlike per-version keys and salts, these change when
+// keys are rotated, so they are only trusted for a limited time.
+type current struct {
+	version uint64
+	salts   []uint64
+	fetched time.Time
+}
+
+// fresh reports whether the entry may still be used. A zero ttl never expires.
+func (c current) fresh(ttl time.Duration) bool {
+	return ttl <= 0 || time.Since(c.fetched) < ttl
+}
+
+// cachedKey is a key cached by version.
+type cachedKey struct {
+	key     *superdog.Key
+	fetched time.Time
+}
+
+// miss records that Vault had no secret at a path, so lookups can fail fast for a while.
+type miss struct {
+	err     error
+	expires time.Time
+}
+
+// missed returns the remembered error for a recently missing key or salt version. The caller must hold v.l.
+func (v *Vault) missed(ckey string) error {
+	m, ok := v.misses[ckey]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(m.expires) {
+		delete(v.misses, ckey)
+		return nil
+	}
+	return m.err
+}
+
+// rememberMiss records err for ckey if it means the version does not exist. The caller must hold v.l.
+func (v *Vault) rememberMiss(ckey string, err error) {
+	if v.NegativeTTL <= 0 || (!errors.Is(err, superdog.ErrUnknownKeyVersion) && !errors.Is(err, superdog.ErrSaltNotFound)) {
+		return
+	}
+	v.misses[ckey] = miss{err: err, expires: time.Now().Add(v.NegativeTTL)}
+}
+
+// Invalidate drops the cached current key and salt versions for prefix, and any versions remembered as missing,
+// so the next lookup goes to Vault. Keys and salts cached by version are immutable and are kept.
+func (v *Vault) Invalidate(prefix string) {
+	v.l.Lock()
+	defer v.l.Unlock()
+
+	delete(v.latestKey, prefix)
+	delete(v.currentSalts, prefix)
+	for ckey := range v.misses {
+		if strings.HasPrefix(ckey, "keys/"+prefix+"/") || strings.HasPrefix(ckey, "salts/"+prefix+"/") {
+			delete(v.misses, ckey)
+		}
+	}
+}
+
+// InvalidateAll drops the cached current key and salt versions, and remembered missing versions, for every prefix.
+func (v *Vault) InvalidateAll() {
+	v.l.Lock()
+	defer v.l.Unlock()
+
+	v.latestKey = make(map[string]current)
+	v.currentSalts = make(map[string]current)
+	v.misses = make(map[string]miss)
+}
+
+// Purge drops the keys and salts of prefix cached by version, destroying the keys and wiping the salts.
+// Keys already returned by GetKey stop working; superdog.Encrypt and Decrypt fetch them again.
+func (v *Vault) Purge(prefix string) {
+	v.l.Lock()
+	defer v.l.Unlock()
+	v.purge(func(ckey string) bool {
+		return strings.HasPrefix(ckey, "keys/"+prefix+"/") || strings.HasPrefix(ckey, "salts/"+prefix+"/")
+	})
+}
+
+// purge evicts the cached keys and salts whose cache keys match. The caller must hold v.l.
+func (v *Vault) purge(match func(ckey string) bool) {
+	for ckey, c := range v.keyCache {
+		if match(ckey) {
+			c.key.Destroy()
+			delete(v.keyCache, ckey)
+		}
+	}
+	for ckey, s := range v.saltCache {
+		if match(ckey) {
+			superdog.Wipe(s)
+			superdog.KeyAllocator.Free(s)
+			delete(v.saltCache, ckey)
+		}
+	}
+}
+
+// Poll refreshes the current key and salt versions of every prefix looked up so far, once every interval, until Close is called.
+// Failed refreshes keep the previous versions and are reported to OnRefreshError.
+func (v *Vault) Poll(interval time.Duration) {
+	v.wg.Add(1)
+	go func() {
+		defer v.wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-v.done:
+				return
+			case <-t.C:
+				v.refresh()
+			}
+		}
+	}()
+}
+
+// Close stops the background token manager and poller, waits for them to return, and purges every cached key and salt.
+// The Vault must not be used after it is closed.
+func (v *Vault) Close() error {
+	v.closed.Do(func() {
+		close(v.done)
+		v.wg.Wait()
+
+		v.l.Lock()
+		defer v.l.Unlock()
+		v.purge(func(string) bool { return true })
+	})
+	return nil
+}
+
+// refresh fetches the current versions of all known prefixes.
+func (v *Vault) refresh() {
+	v.l.Lock()
+	keys := make([]string, 0, len(v.latestKey))
+	for prefix := range v.latestKey {
+		keys = append(keys, prefix)
+	}
+	salts := make([]string, 0, len(v.currentSalts))
+	for prefix := range v.currentSalts {
+		salts = append(salts, prefix)
+	}
+	v.l.Unlock()
+
+	for _, prefix := range keys {
+		c, err := v.loadCurrentKey(prefix)
+		if err != nil {
+			v.refreshFailed(prefix, err)
+			continue
+		}
+		v.log().Debug("Refreshed current key version", superdog.AttrPrefix, prefix, superdog.AttrKeyVersion, c.version)
+	}
+
+	for _, prefix := range salts {
+		c, err := v.loadCurrentSalts(prefix)
+		if err != nil {
+			v.refreshFailed(prefix, err)
+			continue
+		}
+		v.log().Debug("Refreshed current salt versions", superdog.AttrPrefix, prefix, superdog.AttrSaltVersion, c.version)
+	}
+}
+
+func (v *Vault) refreshFailed(prefix string, err error) {
+	v.log().Warn("Refreshing current versions failed", superdog.AttrPrefix, prefix, superdog.AttrError, err)
+	if v.OnRefreshError != nil {
+		v.OnRefreshError(prefix, err)
+	}
+}
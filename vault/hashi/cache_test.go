@@ -0,0 +1,344 @@
+package hashi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xordataexchange/superdog"
+	"github.com/xordataexchange/superdog/vault/hashi/hashitest"
+)
+
+// rotatingHandler serves secret/keys/test/current and secret/salts/test/current, reporting latest as the value of *latest.
+func rotatingHandler(latest *uint64) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		l := atomic.LoadUint64(latest)
+		switch req.URL.Path {
+		case "/v1/secret/keys/test/current":
+			fmt.Fprintf(w, `{"data":{"latest":"%d"}}`, l)
+		case "/v1/secret/salts/test/current":
+			fmt.Fprintf(w, `{"data":{"salts":"1,%d","latest":"%d"}}`, l, l)
+		}
+	}
+}
+
+func TestCurrentKeyVersionTTL(t *testing.T) {
+	latest := uint64(1)
+	c, ln := testHTTPServer(t, rotatingHandler(&latest))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+	v.CurrentKeyTTL = 20 * time.Millisecond
+
+	if version, err := v.CurrentKeyVersion("test"); err != nil || version != 1 {
+		t.Fatal("Expected current key version to be 1", version, err)
+	}
+
+	atomic.StoreUint64(&latest, 2)
+	if version, _ := v.CurrentKeyVersion("test"); version != 1 {
+		t.Fatal("Expected cached key version to be used before the TTL expires")
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if version, err := v.CurrentKeyVersion("test"); err != nil || version != 2 {
+		t.Fatal("Expected key version to be refreshed after the TTL expired", version, err)
+	}
+}
+
+func TestCurrentSaltsTTL(t *testing.T) {
+	latest := uint64(1)
+	c, ln := testHTTPServer(t, rotatingHandler(&latest))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+	v.CurrentSaltsTTL = 20 * time.Millisecond
+
+	if version, err := v.CurrentSaltVersion("test"); err != nil || version != 1 {
+		t.Fatal("Expected current salt version to be 1", version, err)
+	}
+
+	atomic.StoreUint64(&latest, 3)
+	time.Sleep(30 * time.Millisecond)
+
+	salts, err := v.CurrentSalts("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(salts) != 2 || salts[1] != 3 {
+		t.Fatal("Expected salts to be refreshed after the TTL expired", salts)
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	latest := uint64(1)
+	c, ln := testHTTPServer(t, rotatingHandler(&latest))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+
+	v.CurrentKeyVersion("test")
+	v.CurrentSaltVersion("test")
+	atomic.StoreUint64(&latest, 2)
+
+	v.Invalidate("test")
+	if version, _ := v.CurrentKeyVersion("test"); version != 2 {
+		t.Fatal("Expected key version to be fetched again after Invalidate")
+	}
+
+	atomic.StoreUint64(&latest, 3)
+	v.InvalidateAll()
+	if version, _ := v.CurrentSaltVersion("test"); version != 3 {
+		t.Fatal("Expected salt version to be fetched again after InvalidateAll")
+	}
+}
+
+func TestPurge(t *testing.T) {
+	s := hashitest.NewServer()
+	defer s.Close()
+	k, _ := superdog.NewKey(1, superdog.AES, superdog.GCM, bytes.Repeat([]byte{1}, 32))
+	s.PutKey("test", k)
+	s.PutSalt("test", 1, []byte("salt"))
+
+	v, err := NewVault(s.Config())
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+	v.SetToken(s.RootToken)
+
+	cached, _ := v.GetKey("test", 1)
+	salt, _ := v.GetSalt("test", 1)
+	salt[0] = 'X'
+	if again, _ := v.GetSalt("test", 1); string(again) != "salt" {
+		t.Fatal("Expected callers to get a copy of the cached salt")
+	}
+
+	v.Purge("test")
+	if _, err := cached.Encrypt(nil, []byte("value")); err != superdog.ErrKeyDestroyed {
+		t.Fatal("Expected purged key to be destroyed, got", err)
+	}
+	k2, err := v.GetKey("test", 1)
+	if err != nil || k2 == cached {
+		t.Fatal("Expected key to be fetched again after Purge", err)
+	}
+
+	v.Close()
+	if _, err := k2.Encrypt(nil, []byte("value")); err != superdog.ErrKeyDestroyed {
+		t.Fatal("Expected keys to be destroyed on Close, got", err)
+	}
+}
+
+func TestPoll(t *testing.T) {
+	latest := uint64(1)
+	c, ln := testHTTPServer(t, rotatingHandler(&latest))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+	defer v.Close()
+
+	v.CurrentKeyVersion("test")
+	atomic.StoreUint64(&latest, 2)
+	v.Poll(10 * time.Millisecond)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if version, _ := v.CurrentKeyVersion("test"); version == 2 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("Expected poller to refresh the current key version")
+}
+
+func TestCloseWaitsForPoller(t *testing.T) {
+	var requests, finished int32
+	polling := make(chan struct{})
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 2 {
+			close(polling)
+			time.Sleep(50 * time.Millisecond)
+			atomic.StoreInt32(&finished, 1)
+		}
+		w.Write([]byte(`{"data":{"latest":"1"}}`))
+	}
+	c, ln := testHTTPServer(t, http.HandlerFunc(handler))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+
+	v.CurrentKeyVersion("test")
+	v.Poll(time.Millisecond)
+	<-polling
+	v.Close()
+	if atomic.LoadInt32(&finished) != 1 {
+		t.Fatal("Expected Close to wait for the poller's refresh")
+	}
+}
+
+// lookups is a superdog.Metrics counting cache lookups and Vault reads.
+type lookups struct {
+	superdog.NopMetrics
+	l                   sync.Mutex
+	hits, misses, reads int
+}
+
+func (m *lookups) CacheLookup(provider, op, prefix string, hit bool) {
+	m.l.Lock()
+	defer m.l.Unlock()
+	if hit {
+		m.hits++
+	} else {
+		m.misses++
+	}
+}
+
+func (m *lookups) ProviderRequest(provider, op, prefix string, d time.Duration, err error) {
+	m.l.Lock()
+	defer m.l.Unlock()
+	m.reads++
+}
+
+func TestCacheMetrics(t *testing.T) {
+	m := &lookups{}
+
+	s := hashitest.NewServer()
+	defer s.Close()
+	k, _ := superdog.NewKey(1, superdog.AES, superdog.GCM, bytes.Repeat([]byte{1}, 32))
+	s.PutKey("test", k)
+
+	v, err := NewVault(s.Config())
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+	defer v.Close()
+	v.Metrics = m
+	v.SetToken(s.RootToken)
+
+	v.GetKey("test", 1)
+	v.GetKey("test", 1)
+	v.GetKey("test", 1)
+	if m.hits != 2 || m.misses != 1 || m.reads != 1 {
+		t.Fatal("Expected 2 hits, 1 miss and 1 read", m.hits, m.misses, m.reads)
+	}
+}
+
+// spans is a superdog.Tracer recording the cache_hit attribute of each span it starts.
+type spans struct {
+	l    sync.Mutex
+	hits []string
+}
+
+func (s *spans) Start(ctx context.Context, name string) (context.Context, superdog.Span) {
+	return ctx, &span{name: name, t: s}
+}
+
+type span struct {
+	name string
+	t    *spans
+}
+
+func (s *span) SetAttribute(key string, value interface{}) {
+	if key == superdog.AttrCacheHit {
+		s.t.l.Lock()
+		defer s.t.l.Unlock()
+		s.t.hits = append(s.t.hits, fmt.Sprint(s.name, " ", value))
+	}
+}
+
+func (s *span) End(err error) {}
+
+func TestLookupSpans(t *testing.T) {
+	defer func(t superdog.Tracer) { superdog.DefaultTracer = t }(superdog.DefaultTracer)
+	tr := &spans{}
+	superdog.DefaultTracer = tr
+
+	s := hashitest.NewServer()
+	defer s.Close()
+	k, _ := superdog.NewKey(1, superdog.AES, superdog.GCM, bytes.Repeat([]byte{1}, 32))
+	s.PutKey("test", k)
+
+	v, err := NewVault(s.Config())
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+	defer v.Close()
+	v.SetToken(s.RootToken)
+
+	ctx := context.Background()
+	v.CurrentKeyVersionContext(ctx, "test")
+	v.GetKeyContext(ctx, "test", 1)
+	v.GetKeyContext(ctx, "test", 1)
+
+	expected := "[hashi.CurrentKeyVersion false hashi.GetKey false hashi.GetKey true]"
+	if fmt.Sprint(tr.hits) != expected {
+		t.Fatal("Unexpected spans", tr.hits)
+	}
+}
+
+// logBuffer is a concurrency-safe buffer for log output.
+type logBuffer struct {
+	l   sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.l.Lock()
+	defer b.l.Unlock()
+	return b.buf.String()
+}
+
+func TestLogging(t *testing.T) {
+	s := hashitest.NewServer()
+	defer s.Close()
+	k, _ := superdog.NewKey(1, superdog.AES, superdog.GCM, bytes.Repeat([]byte{1}, 32))
+	s.PutKey("test", k)
+
+	v, err := NewVault(s.Config())
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+	defer v.Close()
+	var out logBuffer
+	v.Logger = slog.New(slog.NewTextHandler(&out, nil))
+	v.CurrentKeyTTL = time.Millisecond
+	v.SetToken(s.RootToken)
+
+	v.CurrentKeyVersion("test")
+	k2, _ := superdog.NewKey(2, superdog.AES, superdog.GCM, bytes.Repeat([]byte{2}, 32))
+	s.PutKey("test", k2)
+	time.Sleep(5 * time.Millisecond)
+	v.CurrentKeyVersion("test")
+
+	s.SetError("secret/keys/test", http.StatusInternalServerError, 1)
+	v.GetKey("test", 2)
+
+	logged := out.String()
+	if !strings.Contains(logged, `msg="Current key version changed" superdog.provider=hashi superdog.prefix=test superdog.key_version=2`) {
+		t.Fatal("Expected the rotation to be logged", logged)
+	}
+	if !strings.Contains(logged, `level=WARN msg="Vault read failed" superdog.provider=hashi path=secret/keys/test/2`) {
+		t.Fatal("Expected the failed read to be logged", logged)
+	}
+}
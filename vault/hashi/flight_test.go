@@ -0,0 +1,131 @@
+package hashi
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xordataexchange/superdog"
+)
+
+func TestGetKeyConcurrentMisses(t *testing.T) {
+	resp := `{"data":{"block_mode":"GCM","cipher":"AES","key":"REVGQVVMVCBYT1IgS0VZMQo=","version":"1"}}`
+	var requests int32
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/v1/secret/keys/test/1" {
+			atomic.AddInt32(&requests, 1)
+			time.Sleep(50 * time.Millisecond)
+			w.Write([]byte(resp))
+		}
+	}
+
+	c, ln := testHTTPServer(t, http.HandlerFunc(handler))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := v.GetKey("test", 1); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatal("Expected concurrent misses to share one request, got", n)
+	}
+}
+
+func TestGetKeyDoesNotBlockOtherPrefixes(t *testing.T) {
+	resp := `{"data":{"block_mode":"GCM","cipher":"AES","key":"REVGQVVMVCBYT1IgS0VZMQo=","version":"1"}}`
+	release := make(chan struct{})
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/v1/secret/keys/slow/1" {
+			<-release
+		}
+		w.Write([]byte(resp))
+	}
+
+	c, ln := testHTTPServer(t, http.HandlerFunc(handler))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+
+	if _, err := v.GetKey("fast", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	slow := make(chan error)
+	go func() {
+		_, err := v.GetKey("slow", 1)
+		slow <- err
+	}()
+
+	fast := make(chan error)
+	go func() {
+		_, err := v.GetKey("fast", 1)
+		fast <- err
+	}()
+
+	select {
+	case err := <-fast:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Cached lookup blocked behind a request for another prefix")
+	}
+
+	close(release)
+	if err := <-slow; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetKeyNegativeCache(t *testing.T) {
+	var requests int32
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors":[]}`))
+	}
+
+	c, ln := testHTTPServer(t, http.HandlerFunc(handler))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := v.GetKey("test", 9); !errors.Is(err, superdog.ErrUnknownKeyVersion) {
+			t.Fatal("Expected key not found error, got", err)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatal("Expected missing version to be remembered, got requests:", n)
+	}
+
+	v.Invalidate("test")
+	var e *superdog.Error
+	if _, err := v.GetSalt("test", 9); !errors.Is(err, superdog.ErrSaltNotFound) || !errors.As(err, &e) || e.Prefix != "test" || e.Version != 9 {
+		t.Fatal("Expected salt not found error for test version 9, got", err)
+	}
+	v.Invalidate("test")
+	v.GetKey("test", 9)
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Fatal("Expected Invalidate to forget missing versions, got requests:", n)
+	}
+}
@@ -0,0 +1,18 @@
+/*
+See LICENSE file for license details
+Copyright (c) 2015 XOR Data Exchange, Inc.
+
+
+Package hashitest provides an in-memory fake of the parts of the Vault HTTP API used by package hashi: reading and
+writing secrets in the secret/keys and secret/salts layout, AppID login, token lookup and renewal, and token expiry.
+Errors and latency can be injected to test failure handling without a real Vault.
+
+	s := hashitest.NewServer()
+	defer s.Close()
+	s.PutKey("ssn", key)
+	s.PutSalt("ssn", 1, salt)
+
+	v, _ := hashi.NewVault(s.Config())
+	v.SetToken(s.RootToken)
+*/
+package hashitest
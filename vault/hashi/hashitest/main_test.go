@@ -0,0 +1,16 @@
+package hashitest
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/xordataexchange/superdog"
+)
+
+// TestMain discards log messages, such as the warnings about failed reads, so they do not flood the test output.
+func TestMain(m *testing.M) {
+	superdog.DefaultLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	os.Exit(m.Run())
+}
@@ -0,0 +1,503 @@
+package hashitest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/xordataexchange/superdog"
+)
+
+// Mounts of the default hashi layout, used by a Server returned by NewServer until SetMounts is called.
+const (
+	KeyMount  = "secret/keys"
+	SaltMount = "secret/salts"
+)
+
+// DefaultTokenTTL is the TokenTTL of a Server returned by NewServer.
+const DefaultTokenTTL = time.Hour
+
+type fault struct {
+	status int
+	n      int // requests left to fail; zero fails every request
+}
+
+// Server is a fake Vault server. Secrets are stored as written, under their path without the leading /v1/.
+type Server struct {
+	*httptest.Server
+
+	// RootToken is accepted for every request and never expires. It must not be changed while the server is in use.
+	RootToken string
+	// TokenTTL is the lease of tokens issued by logins and renewals. Use SetTokenTTL to change it while the server
+	// is in use.
+	TokenTTL time.Duration
+	// NonRenewable makes issued tokens non-renewable, so clients must log in again when they expire. Use
+	// SetNonRenewable to change it while the server is in use.
+	NonRenewable bool
+
+	l         sync.Mutex
+	keyMount  string
+	saltMount string
+	secrets   map[string]map[string]interface{}
+	tokens    map[string]time.Time
+	appIDs    map[string]string
+	faults    map[string]*fault
+	latency   time.Duration
+	requests  map[string]int
+	issued    int
+}
+
+// NewServer starts and returns a new Server. The caller should call Close when finished.
+func NewServer() *Server {
+	s := &Server{
+		RootToken: "root",
+		TokenTTL:  DefaultTokenTTL,
+		keyMount:  KeyMount,
+		saltMount: SaltMount,
+		secrets:   make(map[string]map[string]interface{}),
+		tokens:    make(map[string]time.Time),
+		appIDs:    make(map[string]string),
+		faults:    make(map[string]*fault),
+		requests:  make(map[string]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Config returns a configuration for hashi.NewVault pointing at the server. The client's own retries are disabled
+// so injected errors reach the caller.
+func (s *Server) Config() *api.Config {
+	c := api.DefaultConfig()
+	c.Address = s.URL
+	c.MaxRetries = 0
+	return c
+}
+
+// SetMounts sets the mounts PutKey, SetKeyState, SetCurrentKey, PutSalt and SetCurrentSalts store secrets under,
+// matching the KeyMount and SaltMount of the hashi.Options of the client.
+func (s *Server) SetMounts(keyMount, saltMount string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.keyMount, s.saltMount = strings.Trim(keyMount, "/"), strings.Trim(saltMount, "/")
+}
+
+// SetTokenTTL sets TokenTTL.
+func (s *Server) SetTokenTTL(ttl time.Duration) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.TokenTTL = ttl
+}
+
+// SetNonRenewable sets NonRenewable.
+func (s *Server) SetNonRenewable(nonRenewable bool) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.NonRenewable = nonRenewable
+}
+
+// Write stores data at path, e.g. "secret/keys/ssn/1".
+func (s *Server) Write(path string, data map[string]interface{}) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.secrets[path] = data
+}
+
+// Read returns a copy of the data stored at path, or nil.
+func (s *Server) Read(path string) map[string]interface{} {
+	s.l.Lock()
+	defer s.l.Unlock()
+	data, _ := deepCopy(s.secrets[path]).(map[string]interface{})
+	return data
+}
+
+// deepCopy copies the maps and slices of a secret's data, so it can be used without holding s.l.
+func deepCopy(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if v == nil {
+			return v
+		}
+		c := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			c[k] = deepCopy(e)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(v))
+		for i, e := range v {
+			c[i] = deepCopy(e)
+		}
+		return c
+	}
+	return v
+}
+
+// Delete removes the secret at path.
+func (s *Server) Delete(path string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	delete(s.secrets, path)
+}
+
+// PutKey stores k and its lifecycle metadata as version k.Version of prefix, and makes it the current version if it
+// is the highest.
+func (s *Server) PutKey(prefix string, k *superdog.Key) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	version := strconv.FormatUint(k.Version, 10)
+	data := map[string]interface{}{
+		"version":    version,
+		"cipher":     k.Cipher.String(),
+		"block_mode": k.CipherBlockMode.String(),
+		"key":        base64.URLEncoding.EncodeToString(k.Bytes()),
+		"state":      k.State.String(),
+	}
+	for field, t := range map[string]time.Time{"created_at": k.Created, "not_before": k.NotBefore, "expires_at": k.ExpiresAt} {
+		if !t.IsZero() {
+			data[field] = t.Format(time.RFC3339)
+		}
+	}
+	s.secrets[s.keyMount+"/"+prefix+"/"+version] = data
+
+	cur := s.secrets[s.keyMount+"/"+prefix+"/current"]
+	if cur != nil {
+		cl, _ := cur["latest"].(string)
+		if latest, _ := strconv.ParseUint(cl, 10, 64); latest >= k.Version {
+			return
+		}
+	}
+	s.secrets[s.keyMount+"/"+prefix+"/current"] = map[string]interface{}{"latest": version}
+}
+
+// SetKeyState changes the lifecycle state of a stored key version.
+func (s *Server) SetKeyState(prefix string, version uint64, state superdog.KeyState) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	if data := s.secrets[s.keyMount+"/"+prefix+"/"+strconv.FormatUint(version, 10)]; data != nil {
+		data["state"] = state.String()
+	}
+}
+
+// SetCurrentKey makes version the current key version of prefix.
+func (s *Server) SetCurrentKey(prefix string, version uint64) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.secrets[s.keyMount+"/"+prefix+"/current"] = map[string]interface{}{"latest": strconv.FormatUint(version, 10)}
+}
+
+// PutSalt stores salt as version of prefix, adds it to the active salts and makes it the current version if it is
+// the highest.
+func (s *Server) PutSalt(prefix string, version uint64, salt []byte) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	v := strconv.FormatUint(version, 10)
+	s.secrets[s.saltMount+"/"+prefix+"/"+v] = map[string]interface{}{
+		"version": v,
+		"salt":    base64.URLEncoding.EncodeToString(salt),
+	}
+
+	latest := version
+	active := []uint64{version}
+	if cur := s.secrets[s.saltMount+"/"+prefix+"/current"]; cur != nil {
+		cl, _ := cur["latest"].(string)
+		if l, _ := strconv.ParseUint(cl, 10, 64); l > latest {
+			latest = l
+		}
+		salts, _ := cur["salts"].(string)
+		for _, a := range strings.Split(salts, ",") {
+			if av, err := strconv.ParseUint(a, 10, 64); err == nil && av != version {
+				active = append(active, av)
+			}
+		}
+	}
+	s.setCurrentSalts(prefix, latest, active)
+}
+
+// SetCurrentSalts sets the current salt version and the active salt versions of prefix.
+func (s *Server) SetCurrentSalts(prefix string, latest uint64, active []uint64) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.setCurrentSalts(prefix, latest, active)
+}
+
+func (s *Server) setCurrentSalts(prefix string, latest uint64, active []uint64) {
+	sorted := append([]uint64(nil), active...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	versions := make([]string, len(sorted))
+	for i, v := range sorted {
+		versions[i] = strconv.FormatUint(v, 10)
+	}
+	s.secrets[s.saltMount+"/"+prefix+"/current"] = map[string]interface{}{
+		"latest": strconv.FormatUint(latest, 10),
+		"salts":  strings.Join(versions, ","),
+	}
+}
+
+// AddAppID allows logins with the given AppID and UserID.
+func (s *Server) AddAppID(app, user string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.appIDs[app] = user
+}
+
+// IssueToken returns a new token valid for ttl, or forever if ttl is zero.
+func (s *Server) IssueToken(ttl time.Duration) string {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.issue(ttl)
+}
+
+func (s *Server) issue(ttl time.Duration) string {
+	s.issued++
+	token := fmt.Sprintf("token-%d", s.issued)
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	s.tokens[token] = expires
+	return token
+}
+
+// ExpireToken makes token invalid, as if its lease had run out.
+func (s *Server) ExpireToken(token string) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	delete(s.tokens, token)
+}
+
+// SetError makes the next n requests to paths starting with path, e.g. "secret/keys/ssn", fail with status.
+// An n of zero fails every request, and a status of zero removes the fault. When the paths of several faults match a
+// request, the longest applies.
+func (s *Server) SetError(path string, status, n int) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if status == 0 {
+		delete(s.faults, path)
+		return
+	}
+	s.faults[path] = &fault{status: status, n: n}
+}
+
+// SetLatency makes every request wait d before it is answered.
+func (s *Server) SetLatency(d time.Duration) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.latency = d
+}
+
+// Requests returns the number of requests made to path.
+func (s *Server) Requests(path string) int {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.requests[path]
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+
+	s.l.Lock()
+	s.requests[path]++
+	latency := s.latency
+	status := s.fault(path)
+	s.l.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	if status != 0 {
+		writeErrors(w, status, http.StatusText(status))
+		return
+	}
+
+	switch path {
+	case "auth/app-id/login":
+		s.loginAppID(w, r)
+		return
+	case "auth/token/lookup-self":
+		s.lookupSelf(w, r)
+		return
+	case "auth/token/renew-self":
+		s.renewSelf(w, r)
+		return
+	}
+
+	if _, ok := s.valid(r); !ok {
+		writeErrors(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		data := s.Read(path)
+		if data == nil {
+			writeErrors(w, http.StatusNotFound)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"lease_duration": 0, "renewable": false, "data": data})
+	case "PUT", "POST":
+		var data map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			writeErrors(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.Write(path, data)
+		w.WriteHeader(http.StatusNoContent)
+	case "DELETE":
+		s.Delete(path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeErrors(w, http.StatusMethodNotAllowed)
+	}
+}
+
+// fault returns the injected status for path of the fault with the longest matching path, or zero. The caller must
+// hold s.l.
+func (s *Server) fault(path string) int {
+	match := ""
+	var f *fault
+	for p, pf := range s.faults {
+		if strings.HasPrefix(path, p) && (f == nil || len(p) > len(match)) {
+			match, f = p, pf
+		}
+	}
+	if f == nil {
+		return 0
+	}
+
+	switch {
+	case f.n == 1:
+		delete(s.faults, match)
+	case f.n > 1:
+		f.n--
+	}
+	return f.status
+}
+
+// valid returns the request's token and whether it is known and unexpired.
+func (s *Server) valid(r *http.Request) (string, bool) {
+	token := r.Header.Get("X-Vault-Token")
+	if token == "" {
+		return "", false
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+	if token == s.RootToken {
+		return token, true
+	}
+	expires, ok := s.tokens[token]
+	if !ok {
+		return token, false
+	}
+	if !expires.IsZero() && time.Now().After(expires) {
+		delete(s.tokens, token)
+		return token, false
+	}
+	return token, true
+}
+
+func (s *Server) loginAppID(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AppID  string `json:"app_id"`
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeErrors(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.l.Lock()
+	user, ok := s.appIDs[req.AppID]
+	if !ok || user != req.UserID {
+		s.l.Unlock()
+		writeErrors(w, http.StatusBadRequest, "invalid user ID or app ID")
+		return
+	}
+	token := s.issue(s.TokenTTL)
+	s.l.Unlock()
+
+	s.writeAuth(w, token)
+}
+
+func (s *Server) lookupSelf(w http.ResponseWriter, r *http.Request) {
+	token, ok := s.valid(r)
+	if !ok {
+		writeErrors(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	var ttl int64
+	s.l.Lock()
+	if expires := s.tokens[token]; !expires.IsZero() {
+		ttl = int64(time.Until(expires).Seconds())
+	}
+	nonRenewable := s.NonRenewable
+	s.l.Unlock()
+
+	writeJSON(w, map[string]interface{}{"data": map[string]interface{}{
+		"id":        token,
+		"ttl":       ttl,
+		"renewable": ttl > 0 && !nonRenewable,
+	}})
+}
+
+func (s *Server) renewSelf(w http.ResponseWriter, r *http.Request) {
+	token, ok := s.valid(r)
+	if !ok {
+		writeErrors(w, http.StatusForbidden, "permission denied")
+		return
+	}
+
+	s.l.Lock()
+	if token != s.RootToken {
+		if s.NonRenewable {
+			s.l.Unlock()
+			writeErrors(w, http.StatusBadRequest, "lease is not renewable")
+			return
+		}
+		s.tokens[token] = time.Now().Add(s.TokenTTL)
+	}
+	s.l.Unlock()
+	s.writeAuth(w, token)
+}
+
+func (s *Server) writeAuth(w http.ResponseWriter, token string) {
+	s.l.Lock()
+	ttl := int64(s.TokenTTL.Seconds())
+	if token == s.RootToken {
+		ttl = 0
+	}
+	renewable := ttl > 0 && !s.NonRenewable
+	s.l.Unlock()
+
+	writeJSON(w, map[string]interface{}{"auth": map[string]interface{}{
+		"client_token":   token,
+		"lease_duration": ttl,
+		"renewable":      renewable,
+	}})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeErrors(w http.ResponseWriter, status int, errs ...string) {
+	if errs == nil {
+		errs = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"errors": errs})
+}
@@ -0,0 +1,198 @@
+package hashitest
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/xordataexchange/superdog"
+	"github.com/xordataexchange/superdog/vault/hashi"
+)
+
+func TestServerKeysAndSalts(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	k1, _ := superdog.NewKey(1, superdog.AES, superdog.CFB, bytes.Repeat([]byte{1}, 32))
+	k2, _ := superdog.NewKey(2, superdog.AES, superdog.GCM, bytes.Repeat([]byte{2}, 32))
+	s.PutKey("ssn", k2)
+	s.PutKey("ssn", k1)
+	s.PutSalt("ssn", 1, []byte("salt one"))
+	s.PutSalt("ssn", 2, []byte("salt two"))
+
+	v, err := hashi.NewVault(s.Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	v.SetToken(s.RootToken)
+
+	if version, err := v.CurrentKeyVersion("ssn"); err != nil || version != 2 {
+		t.Fatal("Expected current key version 2", version, err)
+	}
+	k, err := v.GetKey("ssn", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.CipherBlockMode != superdog.CFB || !bytes.Equal(k.Bytes(), k1.Bytes()) {
+		t.Fatal("Expected key version 1 to round trip")
+	}
+	if _, err := v.GetKey("ssn", 3); !errors.Is(err, superdog.ErrUnknownKeyVersion) {
+		t.Fatal("Expected key not found error, got", err)
+	}
+
+	salts, err := v.CurrentSalts("ssn")
+	if err != nil || len(salts) != 2 {
+		t.Fatal("Expected two active salts", salts, err)
+	}
+	if version, _ := v.CurrentSaltVersion("ssn"); version != 2 {
+		t.Fatal("Expected current salt version 2, got", version)
+	}
+	if salt, err := v.GetSalt("ssn", 1); err != nil || string(salt) != "salt one" {
+		t.Fatal("Expected salt version 1", err)
+	}
+}
+
+func TestServerMounts(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.SetMounts("kv/keys", "kv/salts")
+
+	k, _ := superdog.NewKey(1, superdog.AES, superdog.GCM, bytes.Repeat([]byte{1}, 32))
+	s.PutKey("ssn", k)
+	s.SetKeyState("ssn", 1, superdog.DecryptOnly)
+	s.PutSalt("ssn", 1, []byte("salt one"))
+
+	v, err := hashi.NewVault(s.Config(), hashi.Options{KeyMount: "kv/keys", SaltMount: "kv/salts"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	v.SetToken(s.RootToken)
+
+	if k, err := v.GetKey("ssn", 1); err != nil || k.State != superdog.DecryptOnly {
+		t.Fatal("Expected key under the custom mount", err)
+	}
+	if salt, err := v.GetSalt("ssn", 1); err != nil || string(salt) != "salt one" {
+		t.Fatal("Expected salt under the custom mount", err)
+	}
+	if s.Read("secret/keys/ssn/1") != nil {
+		t.Fatal("Expected nothing under the default mount")
+	}
+}
+
+func TestServerReadCopies(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	k, _ := superdog.NewKey(1, superdog.AES, superdog.GCM, bytes.Repeat([]byte{1}, 32))
+	s.PutKey("ssn", k)
+
+	data := s.Read("secret/keys/ssn/1")
+	s.SetKeyState("ssn", 1, superdog.Revoked)
+	if data["state"] != superdog.Active.String() {
+		t.Fatal("Expected Read to return a copy, got state", data["state"])
+	}
+
+	// a malformed current secret must not panic
+	s.Write("secret/salts/ssn/current", map[string]interface{}{"latest": 3})
+	s.PutSalt("ssn", 1, []byte("salt one"))
+}
+
+func TestServerWrites(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+
+	v, _ := hashi.NewVault(s.Config())
+	defer v.Close()
+	v.SetToken(s.RootToken)
+
+	client, _ := hashiClient(s)
+	if _, err := client.Logical().Write("secret/keys/dob/current", map[string]interface{}{"latest": "7"}); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := v.CurrentKeyVersion("dob"); err != nil || version != 7 {
+		t.Fatal("Expected written current version", version, err)
+	}
+}
+
+func TestServerTokenExpiry(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.AddAppID("app", "user")
+	s.SetNonRenewable(true)
+
+	k, _ := superdog.NewKey(1, superdog.AES, superdog.GCM, bytes.Repeat([]byte{1}, 32))
+	s.PutKey("ssn", k)
+
+	v, _ := hashi.NewVault(s.Config())
+	defer v.Close()
+	if err := v.AuthAppID("app", "wrong"); err == nil {
+		t.Fatal("Expected login with the wrong user to fail")
+	}
+	if err := v.AuthAppID("app", "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	first := v.Token()
+	s.ExpireToken(first)
+	if _, err := v.GetKey("ssn", 1); err != nil {
+		t.Fatal("Expected client to log in again after the token expired", err)
+	}
+	if v.Token() == first {
+		t.Fatal("Expected a new token")
+	}
+	if n := s.Requests("auth/app-id/login"); n < 3 {
+		t.Fatal("Expected a second successful login, got logins", n)
+	}
+}
+
+func TestServerFaults(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	k, _ := superdog.NewKey(1, superdog.AES, superdog.GCM, bytes.Repeat([]byte{1}, 32))
+	s.PutKey("ssn", k)
+
+	v, _ := hashi.NewVault(s.Config())
+	defer v.Close()
+	v.SetToken(s.RootToken)
+	v.MaxRetries = 0
+
+	s.SetError("secret/keys/ssn", http.StatusServiceUnavailable, 1)
+	if _, err := v.GetKey("ssn", 1); err == nil {
+		t.Fatal("Expected injected error")
+	}
+	if _, err := v.GetKey("ssn", 1); err != nil {
+		t.Fatal("Expected fault to clear after one request", err)
+	}
+
+	// the longest matching fault applies, whatever the order they were set in
+	s.SetError("secret/keys", http.StatusServiceUnavailable, 0)
+	s.SetError("secret/keys/ssn/1", http.StatusNotFound, 0)
+	client, _ := hashiClient(s)
+	for i := 0; i < 10; i++ {
+		if secret, err := client.Logical().Read("secret/keys/ssn/1"); secret != nil || err != nil {
+			t.Fatal("Expected the longest fault to apply, got", err)
+		}
+	}
+	s.SetError("secret/keys", 0, 0)
+	s.SetError("secret/keys/ssn/1", 0, 0)
+
+	s.SetLatency(20 * time.Millisecond)
+	start := time.Now()
+	v.CurrentKeyVersion("ssn")
+	if time.Since(start) < 20*time.Millisecond {
+		t.Fatal("Expected latency to be added")
+	}
+}
+
+func hashiClient(s *Server) (*api.Client, error) {
+	c, err := api.NewClient(s.Config())
+	if err != nil {
+		return nil, err
+	}
+	c.SetToken(s.RootToken)
+	return c, nil
+}
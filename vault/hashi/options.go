@@ -0,0 +1,119 @@
+package hashi
+
+import (
+	"strings"
+)
+
+// Options describes where keys and salts are stored in Vault and how their secrets are laid out.
+// Zero values are replaced with the corresponding value from DefaultOptions.
+type Options struct {
+	KeyMount  string // Mount point of the keys, substituted for {mount} in KeyPath
+	SaltMount string // Mount point of the salts, substituted for {mount} in SaltPath
+
+	// KeyPath and SaltPath are templates for the path of a secret. {mount}, {env} and {prefix} are replaced with
+	// the mount point, Env and the key prefix, and {version} with the version number or "current". An empty Env
+	// leaves out its path segment.
+	KeyPath  string
+	SaltPath string
+	Env      string
+
+	Fields Fields
+
+	// Namespace is the Vault Enterprise namespace sent with every request.
+	Namespace string
+}
+
+// Fields names the fields read from key and salt secrets.
+type Fields struct {
+	Version   string // Version of a key or salt secret
+	Cipher    string // Cipher of a key secret, e.g. "AES"
+	BlockMode string // Cipher block mode of a key secret, e.g. "GCM"
+	Key       string // Base64 encoded key of a key secret
+	Salt      string // Base64 encoded salt of a salt secret
+	Latest    string // Current version in a "current" secret
+	Salts     string // Comma separated active salt versions in a "current" salt secret
+
+	// Optional lifecycle fields of a key secret. Times are RFC 3339, and the state is "active", "decrypt-only" or
+	// "revoked". Keys without them are active and unrestricted.
+	Created   string
+	NotBefore string
+	ExpiresAt string
+	State     string
+}
+
+// DefaultOptions matches the layout of secret/keys/<prefix>/<version> and secret/salts/<prefix>/<version>.
+var DefaultOptions = Options{
+	KeyMount:  "secret/keys",
+	SaltMount: "secret/salts",
+	KeyPath:   "{mount}/{prefix}/{version}",
+	SaltPath:  "{mount}/{prefix}/{version}",
+	Fields: Fields{
+		Version:   "version",
+		Cipher:    "cipher",
+		BlockMode: "block_mode",
+		Key:       "key",
+		Salt:      "salt",
+		Latest:    "latest",
+		Salts:     "salts",
+		Created:   "created_at",
+		NotBefore: "not_before",
+		ExpiresAt: "expires_at",
+		State:     "state",
+	},
+}
+
+// withDefaults returns o with its zero values filled in from DefaultOptions.
+func (o Options) withDefaults() Options {
+	d := DefaultOptions
+	setDefault(&o.KeyMount, d.KeyMount)
+	setDefault(&o.SaltMount, d.SaltMount)
+	setDefault(&o.KeyPath, d.KeyPath)
+	setDefault(&o.SaltPath, d.SaltPath)
+	setDefault(&o.Fields.Version, d.Fields.Version)
+	setDefault(&o.Fields.Cipher, d.Fields.Cipher)
+	setDefault(&o.Fields.BlockMode, d.Fields.BlockMode)
+	setDefault(&o.Fields.Key, d.Fields.Key)
+	setDefault(&o.Fields.Salt, d.Fields.Salt)
+	setDefault(&o.Fields.Latest, d.Fields.Latest)
+	setDefault(&o.Fields.Salts, d.Fields.Salts)
+	setDefault(&o.Fields.Created, d.Fields.Created)
+	setDefault(&o.Fields.NotBefore, d.Fields.NotBefore)
+	setDefault(&o.Fields.ExpiresAt, d.Fields.ExpiresAt)
+	setDefault(&o.Fields.State, d.Fields.State)
+	return o
+}
+
+func setDefault(s *string, d string) {
+	if *s == "" {
+		*s = d
+	}
+}
+
+// keyPath returns the path of the key secret for prefix at version, which may be "current".
+func (o Options) keyPath(prefix, version string) string {
+	return expand(o.KeyPath, o.KeyMount, o.Env, prefix, version)
+}
+
+// saltPath returns the path of the salt secret for prefix at version, which may be "current".
+func (o Options) saltPath(prefix, version string) string {
+	return expand(o.SaltPath, o.SaltMount, o.Env, prefix, version)
+}
+
+// expand fills in tmpl. Empty segments, such as {env} when Env is not set, are left out of the path.
+func expand(tmpl, mount, env, prefix, version string) string {
+	p := strings.NewReplacer(
+		"{mount}", strings.Trim(mount, "/"),
+		"{env}", env,
+		"{prefix}", prefix,
+		"{version}", version,
+	).Replace(tmpl)
+
+	segments := strings.Split(p, "/")
+	kept := segments[:0]
+	for _, s := range segments {
+		if s != "" {
+			kept = append(kept, s)
+		}
+	}
+	return strings.Join(kept, "/")
+}
@@ -0,0 +1,85 @@
+package hashi
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/xordataexchange/superdog"
+)
+
+func TestOptionsPaths(t *testing.T) {
+	o := Options{KeyMount: "/app/keys/", KeyPath: "{mount}/{env}/{prefix}/{version}", Env: "prod"}.withDefaults()
+
+	if p := o.keyPath("ssn", "3"); p != "app/keys/prod/ssn/3" {
+		t.Fatal("Unexpected key path", p)
+	}
+	if p := o.saltPath("ssn", "current"); p != "secret/salts/ssn/current" {
+		t.Fatal("Expected default salt path", p)
+	}
+	if o.Fields.Key != "key" {
+		t.Fatal("Expected default field names to be filled in")
+	}
+}
+
+func TestOptionsEmptyEnv(t *testing.T) {
+	o := Options{KeyPath: "{mount}/{env}/{prefix}/{version}"}.withDefaults()
+
+	if p := o.keyPath("ssn", "3"); p != "secret/keys/ssn/3" {
+		t.Fatal("Expected the empty env segment to be left out", p)
+	}
+}
+
+func TestGetKeyWithOptions(t *testing.T) {
+	key := `{"data":{"mode":"GCM","alg":"AES","material":"REVGQVVMVCBYT1IgS0VZMQo=","v":"1"}}`
+	salt := `{"data":{"material":"QUJDMTIzCg==","v":"1"}}`
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Vault-Namespace") != "team-a/" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch req.URL.Path {
+		case "/v1/kv/staging/keys/test/1":
+			w.Write([]byte(key))
+		case "/v1/kv/staging/salts/test/1":
+			w.Write([]byte(salt))
+		}
+	}
+
+	c, ln := testHTTPServer(t, http.HandlerFunc(handler))
+	defer ln.Close()
+	v, err := NewVault(c, Options{
+		KeyMount:  "kv",
+		SaltMount: "kv",
+		KeyPath:   "{mount}/{env}/keys/{prefix}/{version}",
+		SaltPath:  "{mount}/{env}/salts/{prefix}/{version}",
+		Env:       "staging",
+		Namespace: "team-a/",
+		Fields: Fields{
+			Version:   "v",
+			Cipher:    "alg",
+			BlockMode: "mode",
+			Key:       "material",
+			Salt:      "material",
+		},
+	})
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+
+	k, err := v.GetKey("test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Version != 1 || k.Cipher != superdog.AES || k.CipherBlockMode != superdog.GCM {
+		t.Fatal("Key returned is invalid")
+	}
+
+	s, err := v.GetSalt("test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s, []byte("ABC123")) {
+		t.Fatal("Salt returned does not match.")
+	}
+}
@@ -0,0 +1,142 @@
+package hashi
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/xordataexchange/superdog"
+)
+
+// ErrCircuitOpen is returned without contacting Vault while the circuit breaker is open, wrapped in a
+// *superdog.Error for superdog.ErrProviderUnavailable.
+var ErrCircuitOpen = errors.New("Vault unavailable, circuit breaker open")
+
+// Defaults applied by NewVault.
+const (
+	DefaultRetryWaitMin    = 100 * time.Millisecond
+	DefaultRetryWaitMax    = 2 * time.Second
+	DefaultBreakerCooldown = 30 * time.Second
+)
+
+// breaker tracks consecutive read failures for the circuit breaker.
+type breaker struct {
+	l        sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool // a request is testing whether Vault has recovered
+}
+
+// read reads a path from Vault, retrying failures that mean Vault is unavailable and failing fast while the circuit is open.
+// Those failures are returned as superdog.ErrProviderUnavailable.
+func (v *Vault) read(path string) (*api.Secret, error) {
+	if err := v.allow(); err != nil {
+		return nil, unavailable(err)
+	}
+
+	s, err := v.readAuthed(path)
+	for attempt := 0; attempt < v.MaxRetries && isUnavailable(err); attempt++ {
+		select {
+		case <-v.done:
+			v.record(err)
+			return nil, unavailable(err)
+		case <-time.After(v.backoff(attempt)):
+		}
+
+		v.log().Debug("Retrying Vault read", "path", path, "attempt", attempt+1, superdog.AttrError, err)
+		s, err = v.readAuthed(path)
+	}
+
+	if err != nil {
+		v.log().Warn("Vault read failed", "path", path, superdog.AttrError, err)
+	}
+	v.record(err)
+	if isUnavailable(err) {
+		return nil, unavailable(err)
+	}
+	return s, err
+}
+
+// unavailable wraps err, which means Vault is unavailable.
+func unavailable(err error) error {
+	return &superdog.Error{Err: superdog.ErrProviderUnavailable, Cause: err}
+}
+
+// backoff returns a random wait of up to RetryWaitMin doubled attempt times, capped at RetryWaitMax.
+func (v *Vault) backoff(attempt int) time.Duration {
+	d := v.RetryWaitMin << uint(attempt)
+	if d <= 0 || d > v.RetryWaitMax {
+		d = v.RetryWaitMax
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// allow returns ErrCircuitOpen if requests should not be sent to Vault right now.
+func (v *Vault) allow() error {
+	if v.BreakerThreshold <= 0 {
+		return nil
+	}
+
+	v.breaker.l.Lock()
+	defer v.breaker.l.Unlock()
+
+	if v.breaker.failures < v.BreakerThreshold {
+		return nil
+	}
+	if v.breaker.trial || time.Since(v.breaker.openedAt) < v.BreakerCooldown {
+		return ErrCircuitOpen
+	}
+
+	v.breaker.trial = true
+	return nil
+}
+
+// record updates the circuit breaker with the outcome of a read.
+func (v *Vault) record(err error) {
+	if v.BreakerThreshold <= 0 {
+		return
+	}
+
+	v.breaker.l.Lock()
+	defer v.breaker.l.Unlock()
+
+	v.breaker.trial = false
+	if !isUnavailable(err) {
+		v.breaker.failures = 0
+		return
+	}
+
+	v.breaker.failures++
+	if v.breaker.failures >= v.BreakerThreshold {
+		if v.breaker.failures == v.BreakerThreshold {
+			v.log().Warn("Vault circuit breaker opened", "failures", v.breaker.failures)
+		}
+		v.breaker.openedAt = time.Now()
+	}
+}
+
+// isUnavailable reports whether err means Vault could not be reached or could not serve the request,
+// as opposed to Vault answering that the request is invalid.
+func isUnavailable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, superdog.ErrProviderUnavailable) {
+		return true
+	}
+
+	var re *api.ResponseError
+	if errors.As(err, &re) {
+		return re.StatusCode >= http.StatusInternalServerError || re.StatusCode == http.StatusTooManyRequests
+	}
+
+	var ne net.Error
+	return errors.As(err, &ne)
+}
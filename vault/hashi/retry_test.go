@@ -0,0 +1,189 @@
+package hashi
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xordataexchange/superdog"
+)
+
+func TestReadRetries(t *testing.T) {
+	var requests int32
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"errors":["sealed"]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"latest":"2"}}`))
+	}
+
+	c, ln := testHTTPServer(t, http.HandlerFunc(handler))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+	v.MaxRetries = 3
+	v.RetryWaitMin = time.Millisecond
+	v.RetryWaitMax = 5 * time.Millisecond
+
+	version, err := v.CurrentKeyVersion("test")
+	if err != nil {
+		t.Fatal("Expected read to succeed after retrying", err)
+	}
+	if version != 2 || atomic.LoadInt32(&requests) != 3 {
+		t.Fatal("Expected the third attempt to succeed")
+	}
+}
+
+func TestReadDoesNotRetryClientErrors(t *testing.T) {
+	var requests int32
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"errors":["bad request"]}`))
+	}
+
+	c, ln := testHTTPServer(t, http.HandlerFunc(handler))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+	v.MaxRetries = 3
+	v.RetryWaitMin = time.Millisecond
+
+	if _, err := v.CurrentKeyVersion("test"); err == nil {
+		t.Fatal("Expected error")
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatal("Expected client errors not to be retried, got requests:", n)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	var requests int32
+	var healthy int32
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&healthy) == 0 {
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`{"errors":["down"]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"latest":"1"}}`))
+	}
+
+	c, ln := testHTTPServer(t, http.HandlerFunc(handler))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+	v.BreakerThreshold = 2
+	v.BreakerCooldown = 20 * time.Millisecond
+
+	v.CurrentKeyVersion("a")
+	v.CurrentKeyVersion("b")
+	if _, err := v.CurrentKeyVersion("c"); !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, superdog.ErrProviderUnavailable) {
+		t.Fatal("Expected circuit to be open, got", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Fatal("Expected no request while the circuit is open, got requests:", n)
+	}
+
+	atomic.StoreInt32(&healthy, 1)
+	time.Sleep(30 * time.Millisecond)
+	if _, err := v.CurrentKeyVersion("c"); err != nil {
+		t.Fatal("Expected trial request to close the circuit", err)
+	}
+	if _, err := v.CurrentKeyVersion("d"); err != nil {
+		t.Fatal("Expected circuit to be closed", err)
+	}
+}
+
+func TestServeStale(t *testing.T) {
+	var down int32
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"errors":["sealed"]}`))
+			return
+		}
+		switch req.URL.Path {
+		case "/v1/secret/keys/test/current":
+			w.Write([]byte(`{"data":{"latest":"4"}}`))
+		case "/v1/secret/salts/test/current":
+			w.Write([]byte(`{"data":{"salts":"3,4","latest":"4"}}`))
+		}
+	}
+
+	c, ln := testHTTPServer(t, http.HandlerFunc(handler))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+	v.CurrentKeyTTL = time.Millisecond
+	v.CurrentSaltsTTL = time.Millisecond
+	v.ServeStale = true
+
+	v.CurrentKeyVersion("test")
+	v.CurrentSalts("test")
+	atomic.StoreInt32(&down, 1)
+	time.Sleep(5 * time.Millisecond)
+
+	if version, err := v.CurrentKeyVersion("test"); err != nil || version != 4 {
+		t.Fatal("Expected stale key version while Vault is down", version, err)
+	}
+	if version, err := v.CurrentSaltVersion("test"); err != nil || version != 4 {
+		t.Fatal("Expected stale salt version while Vault is down", version, err)
+	}
+
+	v.ServeStale = false
+	if _, err := v.CurrentKeyVersion("test"); err == nil {
+		t.Fatal("Expected error without ServeStale")
+	}
+}
+
+func TestServeStaleKey(t *testing.T) {
+	var down int32
+	resp := `{"data":{"block_mode":"GCM","cipher":"AES","key":"REVGQVVMVCBYT1IgS0VZMQo=","version":"1"}}`
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"errors":["sealed"]}`))
+			return
+		}
+		w.Write([]byte(resp))
+	}
+
+	c, ln := testHTTPServer(t, http.HandlerFunc(handler))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+	v.KeyTTL = time.Millisecond
+	v.ServeStale = true
+
+	k, err := v.GetKey("test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&down, 1)
+	time.Sleep(5 * time.Millisecond)
+
+	if stale, err := v.GetKey("test", 1); err != nil || stale != k {
+		t.Fatal("Expected expired key while Vault is down", err)
+	}
+
+	v.ServeStale = false
+	if _, err := v.GetKey("test", 1); !errors.Is(err, superdog.ErrProviderUnavailable) {
+		t.Fatal("Expected provider unavailable without ServeStale, got", err)
+	}
+}
@@ -0,0 +1,243 @@
+package hashi
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/xordataexchange/superdog"
+)
+
+// ErrNoAuthMethod is returned when a token needs to be re-acquired but no auth method has been configured.
+var ErrNoAuthMethod = errors.New("No auth method configured")
+
+// AuthMethod logs in to Vault and returns the resulting secret, whose Auth section carries the client token.
+type AuthMethod func() (*api.Secret, error)
+
+// tokenRetryInterval is how long the token manager waits before trying again after a failed renewal and re-authentication.
+var tokenRetryInterval = 10 * time.Second
+
+// tokenLookupRetries is how many times a token lookup that failed because Vault is unavailable is tried.
+var tokenLookupRetries = 5
+
+// tokenLease describes the token currently in use.
+type tokenLease struct {
+	ttl       time.Duration
+	renewable bool
+	lookup    bool // TTL unknown, ask Vault before scheduling a renewal
+	retry     bool // the last attempt failed, try again after tokenRetryInterval
+	failures  int  // failed lookups so far
+}
+
+// renewIn returns how long to wait before refreshing the token, or 0 if it never expires.
+func (l tokenLease) renewIn() time.Duration {
+	if l.retry {
+		return tokenRetryInterval
+	}
+	return l.ttl * 2 / 3
+}
+
+// tokenManager keeps the client token alive in the background.
+type tokenManager struct {
+	l      sync.Mutex
+	auth   AuthMethod
+	leases chan tokenLease
+	start  sync.Once
+}
+
+func newTokenManager() *tokenManager {
+	return &tokenManager{
+		leases: make(chan tokenLease, 1),
+	}
+}
+
+// Authenticate runs the supplied auth method, sets the resulting token for requests and keeps it alive until Close is called.
+// When the token can no longer be renewed, or Vault rejects it, the auth method is run again.
+func (v *Vault) Authenticate(auth AuthMethod) error {
+	v.tokens.l.Lock()
+	defer v.tokens.l.Unlock()
+
+	v.tokens.auth = auth
+	return v.login()
+}
+
+// reauthenticate re-runs the configured auth method, unless the token has already changed since stale was read.
+// OnReauthenticated is called without holding the lock, so it may call back into the Vault.
+func (v *Vault) reauthenticate(stale string) error {
+	v.tokens.l.Lock()
+	if v.client.Token() != stale {
+		v.tokens.l.Unlock()
+		return nil
+	}
+	err := v.login()
+	v.tokens.l.Unlock()
+	if err != nil {
+		return err
+	}
+
+	v.log().Info("Re-authenticated with Vault")
+	if v.OnReauthenticated != nil {
+		v.OnReauthenticated()
+	}
+	return nil
+}
+
+// login runs the auth method and starts watching the new token. The caller must hold v.tokens.l.
+func (v *Vault) login() error {
+	if v.tokens.auth == nil {
+		return ErrNoAuthMethod
+	}
+
+	s, err := v.tokens.auth()
+	if err != nil {
+		return err
+	}
+	if s == nil || s.Auth == nil {
+		return errors.New("Auth method returned no token")
+	}
+
+	v.client.SetToken(s.Auth.ClientToken)
+	v.watchToken(tokenLease{
+		ttl:       time.Duration(s.Auth.LeaseDuration) * time.Second,
+		renewable: s.Auth.Renewable,
+	})
+	return nil
+}
+
+// watchToken hands a new lease to the token manager, starting it if necessary. It never blocks, as the manager
+// itself calls it when logging in again: a lease the manager has not received yet is replaced.
+func (v *Vault) watchToken(lease tokenLease) {
+	v.tokens.start.Do(func() {
+		v.wg.Add(1)
+		go func() {
+			defer v.wg.Done()
+			v.manageToken()
+		}()
+	})
+
+	for {
+		select {
+		case v.tokens.leases <- lease:
+			return
+		default:
+		}
+		select {
+		case <-v.tokens.leases:
+		default:
+		}
+	}
+}
+
+func (v *Vault) manageToken() {
+	var renew <-chan time.Time
+	var lease tokenLease
+
+	for {
+		select {
+		case <-v.done:
+			return
+		case lease = <-v.tokens.leases:
+			if lease.lookup {
+				lease = v.lookupToken(0)
+			}
+		case <-renew:
+			lease = v.refreshToken(lease)
+		}
+
+		renew = nil
+		if d := lease.renewIn(); d > 0 {
+			renew = time.After(d)
+		}
+	}
+}
+
+// refreshToken renews the current token if possible, and falls back to the auth method otherwise.
+func (v *Vault) refreshToken(lease tokenLease) tokenLease {
+	if lease.lookup {
+		return v.lookupToken(lease.failures)
+	}
+
+	if lease.renewable {
+		s, err := v.client.Auth().Token().RenewSelf(0)
+		if err == nil && s != nil && s.Auth != nil && s.Auth.LeaseDuration > 0 {
+			next := tokenLease{
+				ttl:       time.Duration(s.Auth.LeaseDuration) * time.Second,
+				renewable: s.Auth.Renewable,
+			}
+			if next.ttl < lease.ttl {
+				// the token is reaching its max TTL, so log in again before it runs out rather than renew
+				next.renewable = false
+			}
+			v.log().Debug("Renewed Vault token", "ttl", next.ttl)
+			if v.OnTokenRenewed != nil {
+				v.OnTokenRenewed(next.ttl)
+			}
+			return next
+		}
+	}
+
+	token := v.client.Token()
+	if err := v.reauthenticate(token); err != nil {
+		v.log().Error("Vault token could not be renewed or replaced", superdog.AttrError, err)
+		if v.OnTokenError != nil {
+			v.OnTokenError(err)
+		}
+		if err == ErrNoAuthMethod {
+			// nothing more can be done until a new token is set
+			return tokenLease{}
+		}
+		lease.retry = true
+		return lease
+	}
+
+	// the new lease has been queued by reauthenticate
+	return tokenLease{}
+}
+
+// lookupToken asks Vault for the TTL of a token that was set directly, after failures failed lookups. A lookup failing
+// because Vault is unavailable is tried again up to tokenLookupRetries times; other failures, such as a revoked token,
+// are not retried.
+func (v *Vault) lookupToken(failures int) tokenLease {
+	s, err := v.client.Auth().Token().LookupSelf()
+	if err != nil {
+		v.log().Warn("Vault token lookup failed", superdog.AttrError, err)
+		if v.OnTokenError != nil {
+			v.OnTokenError(err)
+		}
+		failures++
+		if !isUnavailable(err) || failures >= tokenLookupRetries {
+			// the token is not renewed; reads rejected with it re-authenticate if an auth method is configured
+			return tokenLease{}
+		}
+		return tokenLease{lookup: true, retry: true, failures: failures}
+	}
+
+	ttl, err := s.TokenTTL()
+	if err != nil {
+		return tokenLease{}
+	}
+	renewable, _ := s.TokenIsRenewable()
+
+	return tokenLease{ttl: ttl, renewable: renewable}
+}
+
+// readAuthed reads a path from Vault, re-authenticating once and retrying if the token has been rejected.
+func (v *Vault) readAuthed(path string) (*api.Secret, error) {
+	token := v.client.Token()
+	s, err := v.logical.Read(path)
+	if !isPermissionDenied(err) {
+		return s, err
+	}
+
+	if rerr := v.reauthenticate(token); rerr != nil {
+		return nil, err
+	}
+	return v.logical.Read(path)
+}
+
+func isPermissionDenied(err error) bool {
+	var re *api.ResponseError
+	return errors.As(err, &re) && re.StatusCode == http.StatusForbidden
+}
@@ -0,0 +1,324 @@
+package hashi
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTokenRenewal(t *testing.T) {
+	login := `{"auth":{"client_token":"renewable-token","lease_duration":1,"renewable":true}}`
+	renewed := `{"auth":{"client_token":"renewable-token","lease_duration":1,"renewable":true}}`
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v1/auth/app-id/login":
+			w.Write([]byte(login))
+		case "/v1/auth/token/renew-self":
+			w.Write([]byte(renewed))
+		}
+	}
+
+	c, ln := testHTTPServer(t, http.HandlerFunc(handler))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+	defer v.Close()
+
+	ttls := make(chan time.Duration, 1)
+	v.OnTokenRenewed = func(ttl time.Duration) {
+		select {
+		case ttls <- ttl:
+		default:
+		}
+	}
+
+	if err := v.AuthAppID("test", "testing"); err != nil {
+		t.Fatal("Failed to authenticate using AppID", err)
+	}
+
+	select {
+	case ttl := <-ttls:
+		if ttl != time.Second {
+			t.Fatal("Expected renewed token to have a 1s TTL, got", ttl)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Expected token to be renewed before it expired")
+	}
+}
+
+func TestTokenReauthWhenNotRenewable(t *testing.T) {
+	var logins int32
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/v1/auth/app-id/login" {
+			atomic.AddInt32(&logins, 1)
+			w.Write([]byte(`{"auth":{"client_token":"short-lived","lease_duration":1,"renewable":false}}`))
+		}
+	}
+
+	c, ln := testHTTPServer(t, http.HandlerFunc(handler))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+	defer v.Close()
+
+	reauthed := make(chan struct{}, 1)
+	v.OnReauthenticated = func() {
+		select {
+		case reauthed <- struct{}{}:
+		default:
+		}
+	}
+
+	if err := v.AuthAppID("test", "testing"); err != nil {
+		t.Fatal("Failed to authenticate using AppID", err)
+	}
+
+	select {
+	case <-reauthed:
+		if atomic.LoadInt32(&logins) < 2 {
+			t.Fatal("Expected auth method to be run again")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Expected re-authentication before the token expired")
+	}
+}
+
+func TestTokenReauthWhenRenewalCapped(t *testing.T) {
+	var logins int32
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v1/auth/app-id/login":
+			atomic.AddInt32(&logins, 1)
+			w.Write([]byte(`{"auth":{"client_token":"capped","lease_duration":3,"renewable":true}}`))
+		case "/v1/auth/token/renew-self":
+			w.Write([]byte(`{"auth":{"client_token":"capped","lease_duration":1,"renewable":true}}`))
+		}
+	}
+
+	c, ln := testHTTPServer(t, http.HandlerFunc(handler))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+	defer v.Close()
+
+	reauthed := make(chan struct{}, 1)
+	v.OnReauthenticated = func() {
+		select {
+		case reauthed <- struct{}{}:
+		default:
+		}
+	}
+
+	if err := v.AuthAppID("test", "testing"); err != nil {
+		t.Fatal("Failed to authenticate using AppID", err)
+	}
+
+	select {
+	case <-reauthed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected re-authentication once renewals stopped extending the token")
+	}
+}
+
+func TestSetTokenConcurrently(t *testing.T) {
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"data":{"ttl":0}}`))
+	}
+
+	c, ln := testHTTPServer(t, http.HandlerFunc(handler))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+	defer v.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					v.SetToken("token")
+					v.ClearToken()
+				}
+			}()
+		}
+		wg.Wait()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected concurrent SetToken calls not to block")
+	}
+}
+
+func TestTokenReauthOnPermissionDenied(t *testing.T) {
+	key := `{"data":{"block_mode":"GCM","cipher":"AES","key":"REVGQVVMVCBYT1IgS0VZMQo=","version":"1"}}`
+	var logins int32
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v1/auth/app-id/login":
+			if atomic.AddInt32(&logins, 1) == 1 {
+				w.Write([]byte(`{"auth":{"client_token":"revoked","lease_duration":0,"renewable":false}}`))
+				return
+			}
+			w.Write([]byte(`{"auth":{"client_token":"fresh","lease_duration":0,"renewable":false}}`))
+		case "/v1/secret/keys/test/1":
+			if req.Header.Get("X-Vault-Token") != "fresh" {
+				w.WriteHeader(http.StatusForbidden)
+				w.Write([]byte(`{"errors":["permission denied"]}`))
+				return
+			}
+			w.Write([]byte(key))
+		}
+	}
+
+	c, ln := testHTTPServer(t, http.HandlerFunc(handler))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+	defer v.Close()
+
+	var reauths int32
+	v.OnReauthenticated = func() {
+		atomic.AddInt32(&reauths, 1)
+	}
+
+	if err := v.AuthAppID("test", "testing"); err != nil {
+		t.Fatal("Failed to authenticate using AppID", err)
+	}
+
+	if _, err := v.GetKey("test", 1); err != nil {
+		t.Fatal("Expected key to be fetched after re-authenticating", err)
+	}
+
+	if v.Token() != "fresh" || atomic.LoadInt32(&reauths) != 1 {
+		t.Fatal("Expected a single re-authentication")
+	}
+}
+
+func TestReauthenticatedCallbackMayUseVault(t *testing.T) {
+	var logins int32
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v1/auth/app-id/login":
+			atomic.AddInt32(&logins, 1)
+			w.Write([]byte(`{"auth":{"client_token":"token","lease_duration":0,"renewable":false}}`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+		}
+	}
+
+	c, ln := testHTTPServer(t, http.HandlerFunc(handler))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+	defer v.Close()
+
+	if err := v.AuthAppID("test", "testing"); err != nil {
+		t.Fatal("Failed to authenticate using AppID", err)
+	}
+	v.OnReauthenticated = func() {
+		v.AuthAppID("test", "testing")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		v.GetKey("test", 1)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected OnReauthenticated to be able to call back into the vault")
+	}
+	if n := atomic.LoadInt32(&logins); n != 3 {
+		t.Fatal("Expected the callback's login to run, got logins", n)
+	}
+}
+
+func TestTokenLookupGivesUp(t *testing.T) {
+	defer func(d time.Duration) { tokenRetryInterval = d }(tokenRetryInterval)
+	tokenRetryInterval = time.Millisecond
+
+	for _, status := range []int{http.StatusForbidden, http.StatusServiceUnavailable} {
+		var lookups int32
+		handler := func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/v1/auth/token/lookup-self" {
+				atomic.AddInt32(&lookups, 1)
+			}
+			w.WriteHeader(status)
+			w.Write([]byte(`{"errors":["failed"]}`))
+		}
+
+		c, ln := testHTTPServer(t, http.HandlerFunc(handler))
+		c.MaxRetries = 0
+		v, err := NewVault(c)
+		if err != nil {
+			t.Fatal("Failed to create vault.", err)
+		}
+		v.SetToken("token")
+		time.Sleep(200 * time.Millisecond)
+		v.Close()
+		ln.Close()
+
+		want := int32(tokenLookupRetries)
+		if status == http.StatusForbidden {
+			want = 1
+		}
+		if n := atomic.LoadInt32(&lookups); n != want {
+			t.Fatal("Expected", want, "lookups for status", status, "got", n)
+		}
+	}
+}
+
+func TestTokenPermissionDeniedWithoutAuthMethod(t *testing.T) {
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errors":["permission denied"]}`))
+	}
+
+	c, ln := testHTTPServer(t, http.HandlerFunc(handler))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+	defer v.Close()
+
+	if _, err := v.GetKey("test", 1); !isPermissionDenied(err) {
+		t.Fatal("Expected permission denied error, got", err)
+	}
+}
+
+func TestClose(t *testing.T) {
+	v, err := NewVault(nil)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+
+	if err := v.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Close(); err != nil {
+		t.Fatal("Expected Close to be idempotent", err)
+	}
+}
@@ -2,58 +2,142 @@ package hashi
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/xordataexchange/superdog"
+	"github.com/xordataexchange/superdog/internal/flight"
 	"github.com/xordataexchange/superdog/vault"
 
 	"github.com/hashicorp/vault/api"
 )
 
-var ErrVersionMismatch = errors.New("Key returned does no match requested version")
+var (
+	ErrVersionMismatch = errors.New("Key returned does no match requested version")
+	// ErrMissingField is returned when a secret lacks a field named in Options.Fields, or the field is not a string.
+	ErrMissingField = errors.New("Secret field missing or not a string")
+)
+
+// DefaultNegativeTTL is the NegativeTTL of a Vault returned by NewVault.
+const DefaultNegativeTTL = 5 * time.Second
 
-var _ vault.Vault = &Vault{}
+var (
+	_ vault.Vault                  = &Vault{}
+	_ vault.KeyMaterialProvider    = &Vault{}
+	_ superdog.ContextKeyProvider  = &Vault{}
+	_ superdog.ContextSaltProvider = &Vault{}
+)
 
 type Vault struct {
+	// OnTokenRenewed is called after the token has been renewed, with its new TTL.
+	OnTokenRenewed func(ttl time.Duration)
+	// OnReauthenticated is called after the auth method has been re-run to replace an expired or rejected token.
+	OnReauthenticated func()
+	// OnTokenError is called when the token could neither be renewed nor replaced.
+	OnTokenError func(err error)
+	// Logger receives messages about token renewal, refreshes of the current versions and failed reads.
+	// Nil uses superdog.DefaultLogger.
+	Logger *slog.Logger
+	// Metrics receives cache lookups and Vault read measurements. Nil uses superdog.DefaultMetrics.
+	Metrics superdog.Metrics
+
+	// CurrentKeyTTL is how long the current key version of a prefix is cached before Vault is asked again. Zero caches it until invalidated.
+	CurrentKeyTTL time.Duration
+	// CurrentSaltsTTL is how long the current salt versions of a prefix are cached before Vault is asked again. Zero caches them until invalidated.
+	CurrentSaltsTTL time.Duration
+	// OnRefreshError is called when the poller fails to refresh the current versions of a prefix.
+	OnRefreshError func(prefix string, err error)
+	// KeyTTL is how long a key version is cached before it is read again, so changes to its lifecycle state, such as
+	// a revocation, are seen. Zero caches keys until they are purged.
+	KeyTTL time.Duration
+	// NegativeTTL is how long a key or salt version that Vault reported missing is remembered, so repeated lookups
+	// don't each make a request. Zero disables negative caching. NewVault sets it to DefaultNegativeTTL.
+	NegativeTTL time.Duration
+
+	// MaxRetries is how many times a read that failed because Vault was unreachable or returned a 5xx is retried.
+	MaxRetries int
+	// RetryWaitMin and RetryWaitMax bound the jittered exponential backoff between retries.
+	RetryWaitMin time.Duration
+	RetryWaitMax time.Duration
+	// BreakerThreshold is the number of consecutive failed reads after which requests fail fast with ErrCircuitOpen,
+	// until BreakerCooldown has passed and a trial request succeeds. Zero disables the circuit breaker.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// ServeStale keeps returning the last known current key and salt versions, and keys read before, even after
+	// their TTL, while Vault is unavailable.
+	ServeStale bool
+
 	client       *api.Client
 	logical      *api.Logical
 	config       *api.Config
-	keyCache     map[string]*superdog.Key
-	latestKey    map[string]uint64
+	options      Options
+	keyCache     map[string]cachedKey
+	latestKey    map[string]current
 	saltCache    map[string][]byte
-	currentSalts map[string][]uint64
-	latestSalt   map[string]uint64
+	currentSalts map[string]current
+	misses       map[string]miss
+	flights      flight.Group
+	breaker      breaker
+	tokens       *tokenManager
+	done         chan struct{}
+	closed       sync.Once
+	wg           sync.WaitGroup // the poller and token manager
 	l            sync.Mutex
 }
 
-// NewVault returns a new hashicorp Vault client
-func NewVault(c *api.Config) (*Vault, error) {
+// NewVault returns a new hashicorp Vault client. Keys and salts are read from the layout described by opts,
+// or DefaultOptions if none are given.
+func NewVault(c *api.Config, opts ...Options) (*Vault, error) {
 	v := Vault{
-		keyCache:     make(map[string]*superdog.Key),
-		latestKey:    make(map[string]uint64),
-		saltCache:    make(map[string][]byte),
-		currentSalts: make(map[string][]uint64),
-		latestSalt:   make(map[string]uint64),
+		keyCache:        make(map[string]cachedKey),
+		latestKey:       make(map[string]current),
+		saltCache:       make(map[string][]byte),
+		currentSalts:    make(map[string]current),
+		misses:          make(map[string]miss),
+		NegativeTTL:     DefaultNegativeTTL,
+		RetryWaitMin:    DefaultRetryWaitMin,
+		RetryWaitMax:    DefaultRetryWaitMax,
+		BreakerCooldown: DefaultBreakerCooldown,
+		tokens:          newTokenManager(),
+		done:            make(chan struct{}),
+		options:         DefaultOptions,
+	}
+	if len(opts) > 0 {
+		v.options = opts[0].withDefaults()
 	}
+
 	client, err := api.NewClient(c)
 	if err != nil {
 		return &v, nil
 	}
 
+	if v.options.Namespace != "" {
+		client.SetNamespace(v.options.Namespace)
+	}
+
 	v.config = c
 	v.client = client
 	v.logical = client.Logical()
 	return &v, nil
 }
 
-// SetToken sets the token cookie to the new value.
+// log returns the logger messages are written to.
+func (v *Vault) log() *slog.Logger {
+	return superdog.LoggerOrDefault(v.Logger).With(superdog.AttrProvider, metricsName)
+}
+
+// SetToken sets the token cookie to the new value, and renews it in the background until Close is called.
 func (v *Vault) SetToken(t string) {
 	v.client.SetToken(t)
+	v.watchToken(tokenLease{lookup: true})
 }
 
 // Token returns the access token currently being used.
@@ -64,50 +148,128 @@ func (v *Vault) Token() string {
 // ClearToken deletes the token cookie if it's set.
 func (v *Vault) ClearToken() {
 	v.client.ClearToken()
+	v.watchToken(tokenLease{})
 }
 
 // AuthAppID authenticates with Vault using an AppID and UserID and sets the access token for requests.
+// The login is repeated whenever the token expires or is rejected.
 func (v *Vault) AuthAppID(app, user string) error {
-	resp, err := v.config.HttpClient.Post(v.config.Address+"/v1/auth/app-id/login", "application/json", strings.NewReader(fmt.Sprintf(
+	return v.Authenticate(func() (*api.Secret, error) {
+		return v.loginAppID(app, user)
+	})
+}
+
+func (v *Vault) loginAppID(app, user string) (*api.Secret, error) {
+	req, err := http.NewRequest("POST", v.config.Address+"/v1/auth/app-id/login", strings.NewReader(fmt.Sprintf(
 		"{\"app_id\":\"%s\", \"user_id\":\"%s\"}", app, user)))
 	if err != nil {
-		return err
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if v.options.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.options.Namespace)
 	}
 
-	var r api.Response
-	r.Response = resp
-	err = r.Error()
+	resp, err := v.config.HttpClient.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	s, err := api.ParseSecret(r.Body)
+	var r api.Response
+	r.Response = resp
+	err = r.Error()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	v.l.Lock()
-	v.client.SetToken(s.Auth.ClientToken)
-	v.l.Unlock()
-
-	return nil
+	return api.ParseSecret(r.Body)
 }
 
 // GetKey fetches the encryption key information for the key version provided.
 func (v *Vault) GetKey(prefix string, version uint64) (*superdog.Key, error) {
-	ckey := prefix + strconv.FormatUint(version, 10)
+	return v.GetKeyContext(context.Background(), prefix, version)
+}
+
+// GetKeyContext is GetKey, traced as a child of the span in ctx.
+func (v *Vault) GetKeyContext(ctx context.Context, prefix string, version uint64) (*superdog.Key, error) {
+	span := startSpan(ctx, "hashi.GetKey", prefix)
+	span.SetAttribute(superdog.AttrKeyVersion, version)
+	k, err := v.getKey(span, prefix, version)
+	span.End(err)
+	return k, err
+}
+
+func (v *Vault) getKey(span superdog.Span, prefix string, version uint64) (*superdog.Key, error) {
+	ckey := "keys/" + prefix + "/" + strconv.FormatUint(version, 10)
 	v.l.Lock()
-	defer v.l.Unlock()
-	if k, ok := v.keyCache[ckey]; ok {
+	if c, ok := v.keyCache[ckey]; ok && (v.KeyTTL <= 0 || time.Since(c.fetched) < v.KeyTTL) {
+		v.l.Unlock()
+		v.cacheLookup(span, "GetKey", prefix, true)
+		return c.key, nil
+	}
+	if err := v.missed(ckey); err != nil {
+		v.l.Unlock()
+		v.cacheLookup(span, "GetKey", prefix, true)
+		return nil, err
+	}
+	v.l.Unlock()
+	v.cacheLookup(span, "GetKey", prefix, false)
+
+	k, err := v.flights.Do(ckey, func() (interface{}, error) {
+		k, err := v.fetchKey(prefix, version)
+		v.l.Lock()
+		defer v.l.Unlock()
+		if err != nil {
+			v.rememberMiss(ckey, err)
+			return nil, err
+		}
+		// a key replaced after KeyTTL may still be in use by callers, so it is left to the garbage collector
+		v.keyCache[ckey] = cachedKey{key: k, fetched: time.Now()}
 		return k, nil
+	})
+	if err != nil {
+		if v.ServeStale && errors.Is(err, superdog.ErrProviderUnavailable) {
+			v.l.Lock()
+			c, ok := v.keyCache[ckey]
+			v.l.Unlock()
+			if ok {
+				return c.key, nil
+			}
+		}
+		return nil, err
+	}
+	return k.(*superdog.Key), nil
+}
+
+func (v *Vault) fetchKey(prefix string, version uint64) (*superdog.Key, error) {
+	m, err := v.GetKeyMaterial(prefix, version)
+	if err != nil {
+		return nil, err
 	}
+	defer superdog.Wipe(m.Key)
+	return m.NewKey(m.Key)
+}
 
-	s, err := v.logical.Read("secret/keys/" + prefix + "/" + strconv.FormatUint(version, 10))
+// GetKeyMaterial reads the key secret for the key version provided and returns its fields without building a key.
+// It is not cached, and is meant for decorators such as kms.Provider that store wrapped keys in Vault.
+func (v *Vault) GetKeyMaterial(prefix string, version uint64) (*vault.KeyMaterial, error) {
+	f := v.options.Fields
+	path := v.options.keyPath(prefix, strconv.FormatUint(version, 10))
+	start := time.Now()
+	s, err := v.read(path)
+	v.observeRequest("GetKey", prefix, start, err)
 	if err != nil {
 		return nil, err
 	}
+	if s == nil {
+		return nil, &superdog.Error{Prefix: prefix, Version: version, Err: superdog.ErrUnknownKeyVersion}
+	}
 
-	sv, err := strconv.ParseUint(s.Data["version"].(string), 10, 64)
+	field, err := stringField(s, path, f.Version)
+	if err != nil {
+		return nil, err
+	}
+	sv, err := strconv.ParseUint(field, 10, 64)
 	if err != nil {
 		return nil, err
 	}
@@ -115,81 +277,217 @@ func (v *Vault) GetKey(prefix string, version uint64) (*superdog.Key, error) {
 		return nil, ErrVersionMismatch
 	}
 
-	var cipher superdog.Cipher
-	switch s.Data["cipher"] {
-	case "AES":
-		cipher = superdog.AES
-	default:
-		return nil, fmt.Errorf("Unsupported cipher %s", s.Data["cipher"])
+	name, _ := s.Data[f.Cipher].(string)
+	cipher, err := superdog.ParseCipher(name)
+	if err != nil {
+		return nil, err
 	}
 
-	var blockMode superdog.CipherBlockMode
-	switch s.Data["block_mode"] {
-	case "CFB":
-		blockMode = superdog.CFB
-	case "CTR":
-		blockMode = superdog.CTR
-	case "OFB":
-		blockMode = superdog.OFB
-	case "GCM":
-		blockMode = superdog.GCM
-	default:
-		return nil, fmt.Errorf("Unsupported cipher block mode %s", s.Data["block_mode"])
+	name, _ = s.Data[f.BlockMode].(string)
+	blockMode, err := superdog.ParseCipherBlockMode(name)
+	if err != nil {
+		return nil, err
 	}
 
-	key, err := base64.URLEncoding.DecodeString(s.Data["key"].(string))
+	field, err = stringField(s, path, f.Key)
 	if err != nil {
 		return nil, err
 	}
-
-	k, err := superdog.NewKey(version, cipher, blockMode, bytes.Trim(key, "\n"))
+	key, err := base64.URLEncoding.DecodeString(field)
 	if err != nil {
 		return nil, err
 	}
-	v.keyCache[ckey] = k
 
-	return k, nil
+	m := &vault.KeyMaterial{Version: version, Cipher: cipher, CipherBlockMode: blockMode, Key: bytes.Trim(key, "\n")}
+	for field, t := range map[string]*time.Time{f.Created: &m.Created, f.NotBefore: &m.NotBefore, f.ExpiresAt: &m.ExpiresAt} {
+		if *t, err = parseTime(s.Data[field]); err != nil {
+			return nil, fmt.Errorf("Invalid %s: %v", field, err)
+		}
+	}
+	name, _ = s.Data[f.State].(string)
+	if m.State, err = superdog.ParseKeyState(name); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// stringField returns the string field name of the secret read from path.
+func stringField(s *api.Secret, path, name string) (string, error) {
+	v, ok := s.Data[name].(string)
+	if !ok {
+		return "", fmt.Errorf("%s: %w: %s", path, ErrMissingField, name)
+	}
+	return v, nil
+}
+
+// parseTime parses an optional RFC 3339 time from a secret's field.
+func parseTime(v interface{}) (time.Time, error) {
+	s, _ := v.(string)
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
 }
 
 // CurrentKeyVersion retrieves the latest version of the specified key to be used
 func (v *Vault) CurrentKeyVersion(prefix string) (uint64, error) {
-	v.l.Lock()
-	defer v.l.Unlock()
+	return v.CurrentKeyVersionContext(context.Background(), prefix)
+}
 
-	if v, ok := v.latestKey[prefix]; ok {
-		return v, nil
+// CurrentKeyVersionContext is CurrentKeyVersion, traced as a child of the span in ctx.
+func (v *Vault) CurrentKeyVersionContext(ctx context.Context, prefix string) (uint64, error) {
+	span := startSpan(ctx, "hashi.CurrentKeyVersion", prefix)
+	version, err := v.currentKeyVersion(span, prefix)
+	if err == nil {
+		span.SetAttribute(superdog.AttrKeyVersion, version)
 	}
+	span.End(err)
+	return version, err
+}
 
-	s, err := v.logical.Read("secret/keys/" + prefix + "/current")
+func (v *Vault) currentKeyVersion(span superdog.Span, prefix string) (uint64, error) {
+	v.l.Lock()
+	c, ok := v.latestKey[prefix]
+	v.l.Unlock()
+	hit := ok && c.fresh(v.CurrentKeyTTL)
+	v.cacheLookup(span, "CurrentKeyVersion", prefix, hit)
+	if hit {
+		return c.version, nil
+	}
+
+	latest, err := v.loadCurrentKey(prefix)
 	if err != nil {
+		if ok && v.ServeStale && isUnavailable(err) {
+			return c.version, nil
+		}
 		return 0, err
 	}
+	return latest.version, nil
+}
+
+// loadCurrentKey fetches and caches the current key version, sharing the request with any concurrent callers.
+func (v *Vault) loadCurrentKey(prefix string) (current, error) {
+	c, err := v.flights.Do("keys/"+prefix+"/current", func() (interface{}, error) {
+		c, err := v.fetchCurrentKey(prefix)
+		if err != nil {
+			return nil, err
+		}
+
+		v.l.Lock()
+		prev, ok := v.latestKey[prefix]
+		v.latestKey[prefix] = c
+		v.l.Unlock()
+		if ok && prev.version != c.version {
+			// the key was rotated in Vault since it was last read
+			v.log().Info("Current key version changed", superdog.AttrPrefix, prefix,
+				superdog.AttrKeyVersion, c.version, "previous_version", prev.version)
+			superdog.Audit(context.Background(), superdog.OpRotate, prefix, c.version, nil)
+		}
+		return c, nil
+	})
+	if err != nil {
+		return current{}, err
+	}
+	return c.(current), nil
+}
 
-	kv, err := strconv.ParseUint(s.Data["latest"].(string), 10, 64)
+func (v *Vault) fetchCurrentKey(prefix string) (current, error) {
+	f := v.options.Fields
+	path := v.options.keyPath(prefix, "current")
+	start := time.Now()
+	s, err := v.read(path)
+	v.observeRequest("CurrentKeyVersion", prefix, start, err)
 	if err != nil {
-		return 0, fmt.Errorf("Error parsing key for %s: %s", prefix, err)
+		return current{}, err
+	}
+	if s == nil {
+		return current{}, &superdog.Error{Prefix: prefix, Err: superdog.ErrUnknownKeyVersion}
 	}
 
-	v.latestKey[prefix] = kv
+	field, err := stringField(s, path, f.Latest)
+	if err != nil {
+		return current{}, err
+	}
+	kv, err := strconv.ParseUint(field, 10, 64)
+	if err != nil {
+		return current{}, fmt.Errorf("Error parsing key for %s: %s", prefix, err)
+	}
 
-	return v.latestKey[prefix], nil
+	return current{version: kv, fetched: time.Now()}, nil
 }
 
 // GetSalt fetches the salt for the prefix and version provided.
 func (v *Vault) GetSalt(prefix string, version uint64) ([]byte, error) {
+	return v.GetSaltContext(context.Background(), prefix, version)
+}
+
+// GetSaltContext is GetSalt, traced as a child of the span in ctx.
+func (v *Vault) GetSaltContext(ctx context.Context, prefix string, version uint64) ([]byte, error) {
+	span := startSpan(ctx, "hashi.GetSalt", prefix)
+	span.SetAttribute(superdog.AttrSaltVersion, version)
+	s, err := v.getSalt(span, prefix, version)
+	span.End(err)
+	return s, err
+}
+
+func (v *Vault) getSalt(span superdog.Span, prefix string, version uint64) ([]byte, error) {
+	ckey := "salts/" + prefix + "/" + strconv.FormatUint(version, 10)
 	v.l.Lock()
-	defer v.l.Unlock()
-	ckey := prefix + strconv.FormatUint(version, 10)
 	if s, ok := v.saltCache[ckey]; ok {
+		v.l.Unlock()
+		v.cacheLookup(span, "GetSalt", prefix, true)
+		return append([]byte(nil), s...), nil
+	}
+	if err := v.missed(ckey); err != nil {
+		v.l.Unlock()
+		v.cacheLookup(span, "GetSalt", prefix, true)
+		return nil, err
+	}
+	v.l.Unlock()
+	v.cacheLookup(span, "GetSalt", prefix, false)
+
+	s, err := v.flights.Do(ckey, func() (interface{}, error) {
+		s, err := v.fetchSalt(prefix, version)
+		v.l.Lock()
+		defer v.l.Unlock()
+		if err != nil {
+			v.rememberMiss(ckey, err)
+			return nil, err
+		}
+
+		// the cache keeps its own copy in KeyAllocator memory, so it can be wiped on eviction
+		cached, err := superdog.KeyAllocator.Alloc(len(s))
+		if err != nil {
+			return nil, err
+		}
+		copy(cached, s)
+		v.saltCache[ckey] = cached
 		return s, nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return append([]byte(nil), s.([]byte)...), nil
+}
 
-	s, err := v.logical.Read("secret/salts/" + prefix + "/" + strconv.FormatUint(version, 10))
+func (v *Vault) fetchSalt(prefix string, version uint64) ([]byte, error) {
+	f := v.options.Fields
+	path := v.options.saltPath(prefix, strconv.FormatUint(version, 10))
+	start := time.Now()
+	s, err := v.read(path)
+	v.observeRequest("GetSalt", prefix, start, err)
 	if err != nil {
 		return nil, err
 	}
+	if s == nil {
+		return nil, &superdog.Error{Prefix: prefix, Version: version, Err: superdog.ErrSaltNotFound}
+	}
 
-	sv, err := strconv.ParseUint(s.Data["version"].(string), 10, 64)
+	field, err := stringField(s, path, f.Version)
+	if err != nil {
+		return nil, err
+	}
+	sv, err := strconv.ParseUint(field, 10, 64)
 	if err != nil {
 		return nil, err
 	}
@@ -197,67 +495,122 @@ func (v *Vault) GetSalt(prefix string, version uint64) ([]byte, error) {
 		return nil, ErrVersionMismatch
 	}
 
-	salt, err := base64.URLEncoding.DecodeString(s.Data["salt"].(string))
+	field, err = stringField(s, path, f.Salt)
+	if err != nil {
+		return nil, err
+	}
+	salt, err := base64.URLEncoding.DecodeString(field)
 	if err != nil {
 		return nil, err
 	}
 
-	v.saltCache[ckey] = bytes.Trim(salt, "\n")
-
-	return v.saltCache[ckey], nil
+	return bytes.Trim(salt, "\n"), nil
 }
 
 // CurrentSaltVersion retrieves the latest version of the specified salt to be used
 func (v *Vault) CurrentSaltVersion(prefix string) (uint64, error) {
-	v.l.Lock()
+	return v.CurrentSaltVersionContext(context.Background(), prefix)
+}
 
-	if version, ok := v.latestSalt[prefix]; ok {
-		v.l.Unlock()
-		return version, nil
+// CurrentSaltVersionContext is CurrentSaltVersion, traced as a child of the span in ctx.
+func (v *Vault) CurrentSaltVersionContext(ctx context.Context, prefix string) (uint64, error) {
+	span := startSpan(ctx, "hashi.CurrentSaltVersion", prefix)
+	c, err := v.currentSaltsFor(span, prefix)
+	if err == nil {
+		span.SetAttribute(superdog.AttrSaltVersion, c.version)
 	}
+	span.End(err)
+	return c.version, err
+}
 
+// CurrentSalts fetches the list of currently active salts for the prefix and version provided.
+func (v *Vault) CurrentSalts(prefix string) ([]uint64, error) {
+	return v.CurrentSaltsContext(context.Background(), prefix)
+}
+
+// CurrentSaltsContext is CurrentSalts, traced as a child of the span in ctx.
+func (v *Vault) CurrentSaltsContext(ctx context.Context, prefix string) ([]uint64, error) {
+	span := startSpan(ctx, "hashi.CurrentSalts", prefix)
+	c, err := v.currentSaltsFor(span, prefix)
+	span.End(err)
+	return c.salts, err
+}
+
+func (v *Vault) currentSaltsFor(span superdog.Span, prefix string) (current, error) {
+	v.l.Lock()
+	c, ok := v.currentSalts[prefix]
 	v.l.Unlock()
-	_, err := v.CurrentSalts(prefix)
-	if err != nil {
-		return 0, err
+	hit := ok && c.fresh(v.CurrentSaltsTTL)
+	v.cacheLookup(span, "CurrentSalts", prefix, hit)
+	if hit {
+		return c, nil
 	}
 
-	v.l.Lock()
-	defer v.l.Unlock()
-	return v.latestSalt[prefix], nil
+	latest, err := v.loadCurrentSalts(prefix)
+	if err != nil {
+		if ok && v.ServeStale && isUnavailable(err) {
+			return c, nil
+		}
+		return current{}, err
+	}
+	return latest, nil
 }
 
-// CurrentSalts fetches the list of currently active salts for the prefix and version provided.
-func (v *Vault) CurrentSalts(prefix string) ([]uint64, error) {
-	v.l.Lock()
-	defer v.l.Unlock()
+// loadCurrentSalts fetches and caches the current salt versions, sharing the request with any concurrent callers.
+func (v *Vault) loadCurrentSalts(prefix string) (current, error) {
+	c, err := v.flights.Do("salts/"+prefix+"/current", func() (interface{}, error) {
+		c, err := v.fetchCurrentSalts(prefix)
+		if err != nil {
+			return nil, err
+		}
 
-	if salts, ok := v.currentSalts[prefix]; ok {
-		return salts, nil
+		v.l.Lock()
+		v.currentSalts[prefix] = c
+		v.l.Unlock()
+		return c, nil
+	})
+	if err != nil {
+		return current{}, err
 	}
+	return c.(current), nil
+}
 
+func (v *Vault) fetchCurrentSalts(prefix string) (current, error) {
+	f := v.options.Fields
 	var salts = make([]uint64, 0)
 
-	s, err := v.logical.Read("secret/salts/" + prefix + "/current")
+	path := v.options.saltPath(prefix, "current")
+	start := time.Now()
+	s, err := v.read(path)
+	v.observeRequest("CurrentSalts", prefix, start, err)
 	if err != nil {
-		return nil, err
+		return current{}, err
+	}
+	if s == nil {
+		return current{}, &superdog.Error{Prefix: prefix, Err: superdog.ErrSaltNotFound}
 	}
 
-	for _, s := range strings.Split(s.Data["salts"].(string), ",") {
+	field, err := stringField(s, path, f.Salts)
+	if err != nil {
+		return current{}, err
+	}
+	for _, s := range strings.Split(field, ",") {
 		sv, err := strconv.ParseUint(s, 10, 64)
 		if err != nil {
-			return nil, err
+			return current{}, err
 		}
 
 		salts = append(salts, sv)
 	}
 
-	sv, err := strconv.ParseUint(s.Data["latest"].(string), 10, 64)
+	field, err = stringField(s, path, f.Latest)
 	if err != nil {
-		return nil, err
+		return current{}, err
+	}
+	sv, err := strconv.ParseUint(field, 10, 64)
+	if err != nil {
+		return current{}, err
 	}
 
-	v.latestSalt[prefix] = sv
-	v.currentSalts[prefix] = salts
-	return salts, nil
+	return current{version: sv, salts: salts, fetched: time.Now()}, nil
 }
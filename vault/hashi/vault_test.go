@@ -2,13 +2,17 @@ package hashi
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/api"
 	"github.com/xordataexchange/superdog"
+	"github.com/xordataexchange/superdog/vault/hashi/hashitest"
 )
 
 func TestGetKey(t *testing.T) {
@@ -79,6 +83,119 @@ func TestGetKeyVersionMismatch(t *testing.T) {
 	}
 }
 
+func TestMissingFields(t *testing.T) {
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		switch req.RequestURI {
+		case "/v1/secret/keys/test/1":
+			w.Write([]byte(`{"data": {"block_mode": "GCM", "cipher": "AES", "key": "REVGQVVMVCBYT1IgS0VZMQo=", "version": 1}}`))
+		case "/v1/secret/keys/test/current":
+			w.Write([]byte(`{"data": {}}`))
+		case "/v1/secret/salts/test/1":
+			w.Write([]byte(`{"data": {"version": "1"}}`))
+		case "/v1/secret/salts/test/current":
+			w.Write([]byte(`{"data": {"latest": "1"}}`))
+		}
+	}
+
+	c, ln := testHTTPServer(t, http.HandlerFunc(handler))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+
+	if _, err := v.GetKey("test", 1); !errors.Is(err, ErrMissingField) || !strings.Contains(err.Error(), "secret/keys/test/1") {
+		t.Fatal("Expected missing field error for a numeric version, got", err)
+	}
+	if _, err := v.CurrentKeyVersion("test"); !errors.Is(err, ErrMissingField) {
+		t.Fatal("Expected missing field error, got", err)
+	}
+	if _, err := v.GetSalt("test", 1); !errors.Is(err, ErrMissingField) || !strings.Contains(err.Error(), "salt") {
+		t.Fatal("Expected missing field error, got", err)
+	}
+	if _, err := v.CurrentSalts("test"); !errors.Is(err, ErrMissingField) {
+		t.Fatal("Expected missing field error, got", err)
+	}
+}
+
+func TestGetKeyMaterial(t *testing.T) {
+	resp := `{
+	"lease_id": "secret/keys/test/1/b34fa8d3-3121-6b24-403a-e0016ec24f29",
+	"lease_duration": 2592000,
+	"renewable": false,
+	"data": {
+		"block_mode": "GCM",
+		"cipher": "AES",
+		"key": "d3JhcHBlZCBrZXk=",
+		"version": "1"
+	}
+}`
+
+	handler := func(w http.ResponseWriter, req *http.Request) {
+		if req.RequestURI == "/v1/secret/keys/test/1" {
+			w.Write([]byte(resp))
+		}
+	}
+
+	c, ln := testHTTPServer(t, http.HandlerFunc(handler))
+	defer ln.Close()
+	v, err := NewVault(c)
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+
+	m, err := v.GetKeyMaterial("test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(m.Key) != "wrapped key" || m.CipherBlockMode != superdog.GCM {
+		t.Fatal("Expected stored key bytes to be returned as is")
+	}
+
+	if _, err := v.GetKey("test", 1); err == nil {
+		t.Fatal("Expected invalid key size error")
+	}
+}
+
+func TestGetKeyLifecycle(t *testing.T) {
+	s := hashitest.NewServer()
+	defer s.Close()
+	k, _ := superdog.NewKey(1, superdog.AES, superdog.GCM, bytes.Repeat([]byte{1}, 32))
+	k.Created = time.Date(2015, 6, 1, 0, 0, 0, 0, time.UTC)
+	k.ExpiresAt = time.Date(2030, 6, 1, 0, 0, 0, 0, time.UTC)
+	k.State = superdog.DecryptOnly
+	s.PutKey("test", k)
+
+	v, err := NewVault(s.Config())
+	if err != nil {
+		t.Fatal("Failed to create vault.", err)
+	}
+	defer v.Close()
+	v.SetToken(s.RootToken)
+	v.KeyTTL = time.Millisecond
+
+	got, err := v.GetKey("test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.State != superdog.DecryptOnly || !got.Created.Equal(k.Created) || !got.ExpiresAt.Equal(k.ExpiresAt) {
+		t.Fatal("Expected lifecycle fields to be read", got.State, got.Created, got.ExpiresAt)
+	}
+
+	s.SetKeyState("test", 1, superdog.Revoked)
+	time.Sleep(5 * time.Millisecond)
+	if got, _ = v.GetKey("test", 1); got == nil || got.State != superdog.Revoked {
+		t.Fatal("Expected revocation to be seen after KeyTTL")
+	}
+
+	s.Write("secret/keys/test/2", map[string]interface{}{
+		"version": "2", "cipher": "AES", "block_mode": "GCM", "key": "MDEyMzQ1Njc4OWFiY2RlZg==", "state": "lost",
+	})
+	if _, err := v.GetKey("test", 2); err == nil {
+		t.Fatal("Expected unknown state error")
+	}
+}
+
 func TestCurrentKeyVersion(t *testing.T) {
 	resp := `{
 	"lease_id": "secret/keys/test/current/b34fa8d3-3121-6b24-403a-e0016ec24f29",
@@ -271,6 +388,7 @@ func testHTTPServer(
 
 	config := api.DefaultConfig()
 	config.Address = fmt.Sprintf("http://%s", ln.Addr())
+	config.MaxRetries = 0
 
 	return config, ln
 }
@@ -0,0 +1,13 @@
+/*
+See LICENSE file for license details
+Copyright (c) 2015 XOR Data Exchange, Inc.
+
+
+Package hsm provides a KeyProvider whose keys are AES objects in a PKCS#11 token, such as a hardware security module.
+Keys are generated inside the token and are neither sensitive-readable nor extractable; encryption and decryption
+are performed by the token with CKM_AES_GCM, so the raw key never reaches Go memory.
+
+Each key version is a separate object, found by its label. The default label of version 3 of the prefix "fields/ssn"
+is "superdog/fields/ssn/3".
+*/
+package hsm
@@ -0,0 +1,321 @@
+package hsm
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/miekg/pkcs11"
+	"github.com/xordataexchange/superdog"
+)
+
+var (
+	ErrModule        = errors.New("PKCS#11 module could not be loaded")
+	ErrTokenNotFound = errors.New("PKCS#11 token not found")
+)
+
+// tagBits is the GCM tag size, matching the tag size used for in-process keys.
+const tagBits = 128
+
+// DefaultCurrentKeyTTL is the CurrentKeyTTL of a Provider returned by Open.
+const DefaultCurrentKeyTTL = time.Minute
+
+var _ superdog.KeyProvider = &Provider{}
+
+// Config describes the token holding the keys.
+type Config struct {
+	Module     string // Path of the PKCS#11 library, e.g. /usr/lib/softhsm/libsofthsm2.so
+	TokenLabel string // Label of the token to use
+	PIN        string // User PIN of the token
+
+	// Label returns the label of the key object for a prefix and version. It defaults to DefaultLabel.
+	Label func(prefix string, version uint64) string
+}
+
+// DefaultLabel returns "superdog/<prefix>/<version>".
+func DefaultLabel(prefix string, version uint64) string {
+	return "superdog/" + prefix + "/" + strconv.FormatUint(version, 10)
+}
+
+// Provider is a KeyProvider whose keys live in a PKCS#11 token.
+// Requests are made over a single session, so they are serialized.
+type Provider struct {
+	// CurrentKeyTTL is how long the current key version of a prefix is cached before the token is searched for a
+	// newer one. Versions generated through the Provider are seen at once. Zero searches on every call.
+	CurrentKeyTTL time.Duration
+
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	label   func(prefix string, version uint64) string
+
+	l       sync.Mutex
+	keys    map[string]*superdog.Key
+	current map[string]current
+}
+
+// current is the highest version of a prefix found in the token, and when it was found.
+type current struct {
+	version uint64
+	checked time.Time
+}
+
+// Open loads the module, logs in to the token and returns a Provider using it. The caller should call Close when finished.
+func Open(c Config) (*Provider, error) {
+	ctx := pkcs11.New(c.Module)
+	if ctx == nil {
+		return nil, ErrModule
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, err
+	}
+
+	p := &Provider{
+		CurrentKeyTTL: DefaultCurrentKeyTTL,
+		ctx:           ctx,
+		label:         c.Label,
+		keys:          make(map[string]*superdog.Key),
+		current:       make(map[string]current),
+	}
+	if p.label == nil {
+		p.label = DefaultLabel
+	}
+
+	slot, err := findSlot(ctx, c.TokenLabel)
+	if err == nil {
+		p.session, err = ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	}
+	if err == nil {
+		err = ctx.Login(p.session, pkcs11.CKU_USER, c.PIN)
+		if err != nil {
+			ctx.CloseSession(p.session)
+		}
+	}
+	if err != nil {
+		ctx.Finalize()
+		ctx.Destroy()
+		return nil, err
+	}
+	return p, nil
+}
+
+func findSlot(ctx *pkcs11.Ctx, label string) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, err
+	}
+	for _, s := range slots {
+		info, err := ctx.GetTokenInfo(s)
+		if err != nil {
+			return 0, err
+		}
+		if info.Label == label {
+			return s, nil
+		}
+	}
+	return 0, ErrTokenNotFound
+}
+
+// Close logs out and releases the module.
+func (p *Provider) Close() error {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	p.ctx.Logout(p.session)
+	p.ctx.CloseSession(p.session)
+	err := p.ctx.Finalize()
+	p.ctx.Destroy()
+	return err
+}
+
+// GetKey returns the key object labelled for prefix and version.
+func (p *Provider) GetKey(prefix string, version uint64) (*superdog.Key, error) {
+	label := p.label(prefix, version)
+
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	if k, ok := p.keys[label]; ok {
+		return k, nil
+	}
+
+	h, err := p.find(label)
+	if err != nil {
+		return nil, err
+	}
+
+	bits, err := p.bits(h)
+	if err != nil {
+		return nil, err
+	}
+
+	k := superdog.NewExternalKey(version, superdog.AES, bits, &sealer{p: p, key: h})
+	p.keys[label] = k
+	return k, nil
+}
+
+// CurrentKeyVersion returns the highest version of prefix with a key object in the token.
+// Versions are numbered from 1 without gaps, so once CurrentKeyTTL has passed a call only checks whether the next
+// version has been created.
+func (p *Provider) CurrentKeyVersion(prefix string) (uint64, error) {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	version, err := p.cachedKeyVersion(prefix)
+	if err != nil {
+		return 0, err
+	}
+	if version == 0 {
+		return 0, superdog.ErrKeyNotFound
+	}
+	return version, nil
+}
+
+// GenerateKey creates a non-extractable AES-256 key object in the token as the next version of prefix,
+// and returns its version.
+func (p *Provider) GenerateKey(prefix string) (uint64, error) {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	version, err := p.currentKeyVersion(prefix)
+	if err != nil {
+		return 0, err
+	}
+	version++
+
+	_, err = p.ctx.GenerateKey(p.session,
+		[]*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_KEY_GEN, nil)},
+		[]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_SECRET_KEY),
+			pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_AES),
+			pkcs11.NewAttribute(pkcs11.CKA_VALUE_LEN, 32),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, p.label(prefix, version)),
+			pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+			pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+			pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+			pkcs11.NewAttribute(pkcs11.CKA_ENCRYPT, true),
+			pkcs11.NewAttribute(pkcs11.CKA_DECRYPT, true),
+		})
+	superdog.Audit(context.Background(), superdog.OpRotate, prefix, version, err)
+	if err != nil {
+		return 0, err
+	}
+	p.current[prefix] = current{version: version, checked: time.Now()}
+	return version, nil
+}
+
+// cachedKeyVersion returns the highest version of prefix found within CurrentKeyTTL, or searches the token for it.
+// The caller must hold p.l.
+func (p *Provider) cachedKeyVersion(prefix string) (uint64, error) {
+	if c, ok := p.current[prefix]; ok && c.version != 0 && time.Since(c.checked) < p.CurrentKeyTTL {
+		return c.version, nil
+	}
+	return p.currentKeyVersion(prefix)
+}
+
+// currentKeyVersion returns the highest version of prefix in the token, or zero if there is none. The caller must hold p.l.
+func (p *Provider) currentKeyVersion(prefix string) (uint64, error) {
+	version := p.current[prefix].version
+	for {
+		_, err := p.find(p.label(prefix, version+1))
+		if err == superdog.ErrKeyNotFound {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		version++
+	}
+	p.current[prefix] = current{version: version, checked: time.Now()}
+	return version, nil
+}
+
+// bits returns the size in bits of the key object h, read from its CKA_VALUE_LEN. The caller must hold p.l.
+func (p *Provider) bits(h pkcs11.ObjectHandle) (int, error) {
+	attrs, err := p.ctx.GetAttributeValue(p.session, h, []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_VALUE_LEN, nil)})
+	if err != nil {
+		return 0, err
+	}
+	// CKA_VALUE_LEN is a CK_ULONG in the byte order and size of the platform
+	var n uint64
+	switch v := attrs[0].Value; len(v) {
+	case 4:
+		n = uint64(binary.NativeEndian.Uint32(v))
+	case 8:
+		n = binary.NativeEndian.Uint64(v)
+	default:
+		return 0, errors.New("PKCS#11 key length could not be read")
+	}
+	return int(n) * 8, nil
+}
+
+// find returns the handle of the secret key object with the given label. The caller must hold p.l.
+func (p *Provider) find(label string) (pkcs11.ObjectHandle, error) {
+	err := p.ctx.FindObjectsInit(p.session, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_SECRET_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	})
+	if err != nil {
+		return 0, err
+	}
+	handles, _, err := p.ctx.FindObjects(p.session, 1)
+	p.ctx.FindObjectsFinal(p.session)
+	if err != nil {
+		return 0, err
+	}
+	if len(handles) == 0 {
+		return 0, superdog.ErrKeyNotFound
+	}
+	return handles[0], nil
+}
+
+// sealer performs GCM with a key object in the token.
+type sealer struct {
+	p   *Provider
+	key pkcs11.ObjectHandle
+}
+
+func (s *sealer) Seal(nonce, plaintext []byte) ([]byte, error) {
+	s.p.l.Lock()
+	defer s.p.l.Unlock()
+
+	params := pkcs11.NewGCMParams(nonce, nil, tagBits)
+	defer params.Free()
+
+	err := s.p.ctx.EncryptInit(s.p.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_GCM, params)}, s.key)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.p.ctx.Encrypt(s.p.session, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	// some tokens choose their own IV
+	if iv := params.IV(); len(iv) == len(nonce) {
+		copy(nonce, iv)
+	}
+	return b, nil
+}
+
+func (s *sealer) Open(nonce, ciphertext []byte) ([]byte, error) {
+	s.p.l.Lock()
+	defer s.p.l.Unlock()
+
+	params := pkcs11.NewGCMParams(nonce, nil, tagBits)
+	defer params.Free()
+
+	err := s.p.ctx.DecryptInit(s.p.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_GCM, params)}, s.key)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.p.ctx.Decrypt(s.p.session, ciphertext)
+	if err == pkcs11.Error(pkcs11.CKR_ENCRYPTED_DATA_INVALID) || err == pkcs11.Error(pkcs11.CKR_ENCRYPTED_DATA_LEN_RANGE) {
+		return nil, &superdog.Error{Err: superdog.ErrAuthenticationFailed, Cause: err}
+	}
+	return b, err
+}
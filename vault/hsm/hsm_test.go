@@ -0,0 +1,168 @@
+package hsm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/pkcs11"
+	"github.com/xordataexchange/superdog"
+)
+
+// softHSM returns the path of the SoftHSMv2 library, from $SOFTHSM2_MODULE or a common install location.
+func softHSM(t *testing.T) string {
+	paths := []string{
+		os.Getenv("SOFTHSM2_MODULE"),
+		"/usr/lib/softhsm/libsofthsm2.so",
+		"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+		"/usr/lib64/pkcs11/libsofthsm2.so",
+		"/usr/local/lib/softhsm/libsofthsm2.so",
+	}
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	t.Skip("SoftHSMv2 not installed")
+	return ""
+}
+
+// testToken initializes a token labelled "superdog" with user PIN 1234 in a temporary SoftHSM store.
+func testToken(t *testing.T) Config {
+	module := softHSM(t)
+
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "softhsm2.conf")
+	if err := os.Mkdir(filepath.Join(dir, "tokens"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(conf, []byte("directories.tokendir = "+filepath.Join(dir, "tokens")+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOFTHSM2_CONF", conf)
+
+	ctx := pkcs11.New(module)
+	if ctx == nil {
+		t.Fatal("Failed to load", module)
+	}
+	defer ctx.Destroy()
+	if err := ctx.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Finalize()
+
+	slots, err := ctx.GetSlotList(false)
+	if err != nil || len(slots) == 0 {
+		t.Fatal("Expected a free slot", err)
+	}
+	if err := ctx.InitToken(slots[0], "5678", "superdog"); err != nil {
+		t.Fatal(err)
+	}
+
+	// SoftHSM moves an initialized token to a new slot
+	slot, err := findSlot(ctx, "superdog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.CloseSession(s)
+	if err := ctx.Login(s, pkcs11.CKU_SO, "5678"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.InitPIN(s, "1234"); err != nil {
+		t.Fatal(err)
+	}
+	ctx.Logout(s)
+
+	return Config{Module: module, TokenLabel: "superdog", PIN: "1234"}
+}
+
+func TestProvider(t *testing.T) {
+	p, err := Open(testToken(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if _, err := p.CurrentKeyVersion("ssn"); err != superdog.ErrKeyNotFound {
+		t.Fatal("Expected key not found error, got", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := p.GenerateKey("ssn"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	version, err := p.CurrentKeyVersion("ssn")
+	if err != nil || version != 2 {
+		t.Fatal("Expected current version 2", version, err)
+	}
+
+	k, err := p.GetKey("ssn", version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.Bytes() != nil {
+		t.Fatal("Expected key bytes to stay in the token")
+	}
+	if k.Bits() != 256 {
+		t.Fatal("Expected the key size of the token object, got", k.Bits())
+	}
+
+	b, err := k.Encrypt(nil, []byte("4111 1111 1111 1111"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := k.Decrypt(nil, b[8:])
+	if err != nil || string(plain) != "4111 1111 1111 1111" {
+		t.Fatal("Expected round trip through the token", err)
+	}
+
+	other, _ := p.GetKey("ssn", 1)
+	if _, err := other.Decrypt(nil, b[8:]); err == nil {
+		t.Fatal("Expected decryption with another version to fail")
+	}
+
+	if _, err := p.GetKey("ssn", 3); err != superdog.ErrKeyNotFound {
+		t.Fatal("Expected key not found error, got", err)
+	}
+}
+
+func TestCurrentKeyVersionCached(t *testing.T) {
+	p, err := Open(testToken(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	for i := 0; i < 2; i++ {
+		if _, err := p.GenerateKey("card"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// as if version 2 had been generated by another process after version 1 was found
+	p.current["card"] = current{version: 1, checked: time.Now()}
+
+	if version, _ := p.CurrentKeyVersion("card"); version != 1 {
+		t.Fatal("Expected the cached current version 1, got", version)
+	}
+	p.CurrentKeyTTL = 0
+	if version, _ := p.CurrentKeyVersion("card"); version != 2 {
+		t.Fatal("Expected current version 2 once the cache expired, got", version)
+	}
+}
+
+func TestOpenUnknownToken(t *testing.T) {
+	c := testToken(t)
+	c.TokenLabel = "missing"
+	if _, err := Open(c); err != ErrTokenNotFound {
+		t.Fatal("Expected token not found error, got", err)
+	}
+}
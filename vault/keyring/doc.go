@@ -0,0 +1,9 @@
+/*
+See LICENSE file for license details
+Copyright (c) 2015 XOR Data Exchange, Inc.
+
+
+Package keyring provides an implementation of the vault interface backed by a local file, sealed with a passphrase.
+It is intended for small services, CI jobs and air-gapped installs where running Vault is not practical.
+*/
+package keyring
@@ -0,0 +1,322 @@
+package keyring
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/xordataexchange/superdog"
+	"github.com/xordataexchange/superdog/vault"
+)
+
+var _ vault.Vault = &Keyring{}
+
+// Keyring holds versioned keys and salts per prefix. It is safe for concurrent use.
+type Keyring struct {
+	l     sync.RWMutex
+	keys  map[string]*keySet
+	salts map[string]*saltSet
+	cache map[string]map[uint64]*superdog.Key
+}
+
+// keySet is the stored form of all versions of a prefix's key.
+type keySet struct {
+	Current  uint64              `json:"current"`
+	Versions map[uint64]keyEntry `json:"versions"`
+}
+
+type keyEntry struct {
+	Cipher    string    `json:"cipher"`
+	BlockMode string    `json:"block_mode"`
+	Key       []byte    `json:"key"`
+	Created   time.Time `json:"created,omitempty"`
+}
+
+// saltSet is the stored form of all versions of a prefix's salt.
+type saltSet struct {
+	Current  uint64            `json:"current"`
+	Active   []uint64          `json:"active"`
+	Versions map[uint64][]byte `json:"versions"`
+}
+
+// contents is the plaintext of a sealed keyring file.
+type contents struct {
+	Keys  map[string]*keySet  `json:"keys"`
+	Salts map[string]*saltSet `json:"salts"`
+}
+
+// New returns an empty Keyring.
+func New() *Keyring {
+	return &Keyring{
+		keys:  make(map[string]*keySet),
+		salts: make(map[string]*saltSet),
+		cache: make(map[string]map[uint64]*superdog.Key),
+	}
+}
+
+// Load reads and unseals the keyring stored at path.
+func Load(path string, passphrase []byte) (*Keyring, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := unseal(b, passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	var c contents
+	if err := json.Unmarshal(plain, &c); err != nil {
+		return nil, err
+	}
+
+	k := New()
+	for prefix, ks := range c.Keys {
+		if ks == nil {
+			ks = &keySet{}
+		}
+		if ks.Versions == nil {
+			ks.Versions = make(map[uint64]keyEntry)
+		}
+		for version, e := range ks.Versions {
+			if _, err := e.key(version); err != nil {
+				return nil, err
+			}
+		}
+		k.keys[prefix] = ks
+	}
+	for prefix, ss := range c.Salts {
+		if ss == nil {
+			ss = &saltSet{}
+		}
+		if ss.Versions == nil {
+			ss.Versions = make(map[uint64][]byte)
+		}
+		k.salts[prefix] = ss
+	}
+	return k, nil
+}
+
+// Save seals the keyring with passphrase and writes it to path, replacing any existing file atomically.
+func (k *Keyring) Save(path string, passphrase []byte) error {
+	k.l.RLock()
+	plain, err := json.Marshal(contents{Keys: k.keys, Salts: k.salts})
+	k.l.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	b, err := seal(plain, passphrase)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// AddKey stores key as the next version for prefix and makes it the current version. It returns the new version.
+func (k *Keyring) AddKey(prefix string, c superdog.Cipher, bm superdog.CipherBlockMode, key []byte) (uint64, error) {
+	e := keyEntry{Cipher: c.String(), BlockMode: bm.String(), Key: append([]byte(nil), key...), Created: time.Now()}
+
+	k.l.Lock()
+	defer k.l.Unlock()
+
+	ks, ok := k.keys[prefix]
+	if !ok {
+		ks = &keySet{Versions: make(map[uint64]keyEntry)}
+	}
+
+	var version uint64
+	for v := range ks.Versions {
+		if v > version {
+			version = v
+		}
+	}
+	version++
+
+	if _, err := e.key(version); err != nil {
+		return 0, err
+	}
+
+	ks.Versions[version] = e
+	ks.Current = version
+	k.keys[prefix] = ks
+	superdog.Audit(context.Background(), superdog.OpRotate, prefix, version, nil)
+	return version, nil
+}
+
+// GenerateKey adds a random key of size bytes for prefix, as AddKey does.
+func (k *Keyring) GenerateKey(prefix string, c superdog.Cipher, bm superdog.CipherBlockMode, size int) (uint64, error) {
+	key := make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return 0, err
+	}
+	return k.AddKey(prefix, c, bm, key)
+}
+
+// AddSalt stores salt as the next version for prefix, adds it to the active salts and makes it the current version.
+// It returns the new version.
+func (k *Keyring) AddSalt(prefix string, salt []byte) (uint64, error) {
+	k.l.Lock()
+	defer k.l.Unlock()
+
+	ss, ok := k.salts[prefix]
+	if !ok {
+		ss = &saltSet{Versions: make(map[uint64][]byte)}
+	}
+
+	var version uint64
+	for v := range ss.Versions {
+		if v > version {
+			version = v
+		}
+	}
+	version++
+
+	ss.Versions[version] = append([]byte(nil), salt...)
+	ss.Active = append(ss.Active, version)
+	ss.Current = version
+	k.salts[prefix] = ss
+	superdog.Audit(context.Background(), superdog.OpRotate, prefix, version, nil)
+	return version, nil
+}
+
+// GenerateSalt adds a random salt of size bytes for prefix, as AddSalt does.
+func (k *Keyring) GenerateSalt(prefix string, size int) (uint64, error) {
+	salt := make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return 0, err
+	}
+	return k.AddSalt(prefix, salt)
+}
+
+// GetKey returns the key for prefix at version.
+func (k *Keyring) GetKey(prefix string, version uint64) (*superdog.Key, error) {
+	k.l.RLock()
+	if key, ok := k.cache[prefix][version]; ok {
+		k.l.RUnlock()
+		return key, nil
+	}
+	k.l.RUnlock()
+
+	k.l.Lock()
+	defer k.l.Unlock()
+
+	// another caller may have derived the key while the lock was released
+	if key, ok := k.cache[prefix][version]; ok {
+		return key, nil
+	}
+
+	ks, ok := k.keys[prefix]
+	if !ok {
+		return nil, superdog.ErrKeyNotFound
+	}
+	e, ok := ks.Versions[version]
+	if !ok {
+		return nil, superdog.ErrKeyNotFound
+	}
+
+	key, err := e.key(version)
+	if err != nil {
+		return nil, err
+	}
+
+	if k.cache[prefix] == nil {
+		k.cache[prefix] = make(map[uint64]*superdog.Key)
+	}
+	k.cache[prefix][version] = key
+	return key, nil
+}
+
+// CurrentKeyVersion returns the version of the key to encrypt with for prefix.
+func (k *Keyring) CurrentKeyVersion(prefix string) (uint64, error) {
+	k.l.RLock()
+	defer k.l.RUnlock()
+
+	ks, ok := k.keys[prefix]
+	if !ok {
+		return 0, superdog.ErrKeyNotFound
+	}
+	return ks.Current, nil
+}
+
+// GetSalt returns the salt for prefix at version.
+func (k *Keyring) GetSalt(prefix string, version uint64) ([]byte, error) {
+	k.l.RLock()
+	defer k.l.RUnlock()
+
+	ss, ok := k.salts[prefix]
+	if !ok {
+		return nil, superdog.ErrSaltNotFound
+	}
+	s, ok := ss.Versions[version]
+	if !ok {
+		return nil, superdog.ErrSaltNotFound
+	}
+	return append([]byte(nil), s...), nil
+}
+
+// CurrentSalts returns the versions of the salts still in use for prefix.
+func (k *Keyring) CurrentSalts(prefix string) ([]uint64, error) {
+	k.l.RLock()
+	defer k.l.RUnlock()
+
+	ss, ok := k.salts[prefix]
+	if !ok {
+		return nil, superdog.ErrSaltNotFound
+	}
+	return append([]uint64(nil), ss.Active...), nil
+}
+
+// CurrentSaltVersion returns the version of the salt to hash with for prefix.
+func (k *Keyring) CurrentSaltVersion(prefix string) (uint64, error) {
+	k.l.RLock()
+	defer k.l.RUnlock()
+
+	ss, ok := k.salts[prefix]
+	if !ok {
+		return 0, superdog.ErrSaltNotFound
+	}
+	return ss.Current, nil
+}
+
+func (e keyEntry) key(version uint64) (*superdog.Key, error) {
+	c, err := superdog.ParseCipher(e.Cipher)
+	if err != nil {
+		return nil, err
+	}
+	bm, err := superdog.ParseCipherBlockMode(e.BlockMode)
+	if err != nil {
+		return nil, err
+	}
+	k, err := superdog.NewKey(version, c, bm, e.Key)
+	if err != nil {
+		return nil, err
+	}
+	k.Created = e.Created
+	return k, nil
+}
@@ -0,0 +1,217 @@
+package keyring
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/xordataexchange/superdog"
+)
+
+func TestAddKey(t *testing.T) {
+	k := New()
+	v1, err := k.GenerateKey("ssn", superdog.AES, superdog.CFB, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := k.GenerateKey("ssn", superdog.AES, superdog.GCM, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v1 != 1 || v2 != 2 {
+		t.Fatal("Expected versions to be assigned in order", v1, v2)
+	}
+
+	current, err := k.CurrentKeyVersion("ssn")
+	if err != nil || current != 2 {
+		t.Fatal("Expected newest key to be current", current, err)
+	}
+
+	key, err := k.GetKey("ssn", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Version != 1 || key.CipherBlockMode != superdog.CFB {
+		t.Fatal("Key returned is invalid")
+	}
+
+	if _, err := k.GetKey("ssn", 3); err != superdog.ErrKeyNotFound {
+		t.Fatal("Expected key not found error, got", err)
+	}
+	if _, err := k.AddKey("ssn", superdog.AES, superdog.GCM, []byte("too short")); err == nil {
+		t.Fatal("Expected invalid key to be rejected")
+	}
+}
+
+func TestAddSalt(t *testing.T) {
+	k := New()
+	k.AddSalt("email", []byte("first"))
+	k.AddSalt("email", []byte("second"))
+
+	salts, err := k.CurrentSalts("email")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(salts) != 2 {
+		t.Fatal("Expected 2 active salts")
+	}
+
+	current, _ := k.CurrentSaltVersion("email")
+	salt, err := k.GetSalt("email", current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(salt, []byte("second")) {
+		t.Fatal("Expected newest salt to be current")
+	}
+}
+
+func TestGetKeyConcurrent(t *testing.T) {
+	k := New()
+	k.GenerateKey("ssn", superdog.AES, superdog.GCM, 32)
+
+	keys := make([]*superdog.Key, 8)
+	var wg sync.WaitGroup
+	for i := range keys {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			keys[i], _ = k.GetKey("ssn", 1)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, key := range keys {
+		if key == nil || key != keys[0] {
+			t.Fatal("Expected concurrent misses to share one key")
+		}
+	}
+}
+
+type auditRecorder struct {
+	l      sync.Mutex
+	events []superdog.AuditEvent
+}
+
+func (r *auditRecorder) Audit(e superdog.AuditEvent) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	r.events = append(r.events, e)
+}
+
+func TestAddAudited(t *testing.T) {
+	r := &auditRecorder{}
+	defer func(s superdog.AuditSink) { superdog.DefaultAuditSink = s }(superdog.DefaultAuditSink)
+	superdog.DefaultAuditSink = r
+
+	k := New()
+	k.GenerateKey("ssn", superdog.AES, superdog.GCM, 32)
+	k.AddSalt("email", []byte("first"))
+
+	if len(r.events) != 2 {
+		t.Fatal("Expected an audit event per addition, got", len(r.events))
+	}
+	for i, prefix := range []string{"ssn", "email"} {
+		if e := r.events[i]; e.Op != superdog.OpRotate || e.Prefix != prefix || e.KeyVersion != 1 {
+			t.Fatal("Unexpected audit event", e)
+		}
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	passphrase := []byte("correct horse battery staple")
+
+	k := New()
+	k.GenerateKey("ssn", superdog.AES, superdog.GCM, 32)
+	k.AddSalt("ssn", []byte("pepper"))
+	if err := k.Save(path, passphrase); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(b, []byte("pepper")) || bytes.Contains(b, []byte("GCM")) {
+		t.Fatal("Expected keyring to be sealed at rest")
+	}
+
+	loaded, err := Load(path, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orig, _ := k.GetKey("ssn", 1)
+	key, err := loaded.GetKey("ssn", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct, err := orig.Encrypt(nil, []byte("Test Value"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt, err := key.Decrypt(ct, ct[8:])
+	if err != nil || string(pt) != "Test Value" {
+		t.Fatal("Expected loaded key to decrypt", err)
+	}
+
+	salt, err := loaded.GetSalt("ssn", 1)
+	if err != nil || !bytes.Equal(salt, []byte("pepper")) {
+		t.Fatal("Expected loaded salt to match", err)
+	}
+
+	if _, err := Load(path, []byte("wrong")); err != ErrBadPassphrase {
+		t.Fatal("Expected bad passphrase error, got", err)
+	}
+}
+
+func TestLoadLimitsKeyDerivation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	passphrase := []byte("correct horse battery staple")
+	if err := New().Save(path, passphrase); err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := os.ReadFile(path)
+	var s sealed
+	if err := json.Unmarshal(b, &s); err != nil {
+		t.Fatal(err)
+	}
+	s.N = 1 << 30
+	b, _ = json.Marshal(s)
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(path, passphrase); err == nil || err == ErrBadPassphrase {
+		t.Fatal("Expected excessive scrypt parameters to be rejected, got", err)
+	}
+}
+
+func TestLoadEmptyVersions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	passphrase := []byte("correct horse battery staple")
+	b, err := seal([]byte(`{"keys":{"ssn":{"current":0}},"salts":{"ssn":{"current":0,"versions":null}}}`), passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := Load(path, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.GenerateKey("ssn", superdog.AES, superdog.GCM, 32); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.AddSalt("ssn", []byte("pepper")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,95 @@
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrBadPassphrase is returned by Load when the keyring cannot be unsealed, either because the passphrase is wrong or the file has been modified.
+var ErrBadPassphrase = errors.New("Keyring could not be unsealed, wrong passphrase or corrupt file")
+
+// scrypt cost parameters for newly sealed keyrings. Files asking for more are rejected, so a crafted file can not
+// make Load spend unbounded CPU and memory.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// sealed is the on-disk format of a keyring: its JSON contents encrypted with AES-256-GCM under a key derived from the passphrase.
+type sealed struct {
+	KDF   string `json:"kdf"`
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+func seal(plain, passphrase []byte) ([]byte, error) {
+	s := sealed{KDF: "scrypt", N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, 16)}
+	if _, err := io.ReadFull(rand.Reader, s.Salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := s.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Nonce = make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, s.Nonce); err != nil {
+		return nil, err
+	}
+	s.Data = aead.Seal(nil, s.Nonce, plain, []byte(s.KDF))
+
+	return json.MarshalIndent(s, "", "\t")
+}
+
+func unseal(b, passphrase []byte) ([]byte, error) {
+	var s sealed
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	if s.KDF != "scrypt" {
+		return nil, errors.New("Unsupported keyring key derivation " + s.KDF)
+	}
+	if s.N > scryptN || s.R > scryptR || s.P > scryptP {
+		return nil, errors.New("Keyring key derivation parameters exceed limits")
+	}
+
+	aead, err := s.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Nonce) != aead.NonceSize() {
+		return nil, ErrBadPassphrase
+	}
+
+	plain, err := aead.Open(nil, s.Nonce, s.Data, []byte(s.KDF))
+	if err != nil {
+		return nil, ErrBadPassphrase
+	}
+	return plain, nil
+}
+
+// aead derives the sealing key from passphrase using the parameters in s.
+func (s sealed) aead(passphrase []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, s.Salt, s.N, s.R, s.P, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
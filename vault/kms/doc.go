@@ -0,0 +1,13 @@
+/*
+See LICENSE file for license details
+Copyright (c) 2015 XOR Data Exchange, Inc.
+
+
+Package kms provides envelope encryption for stored keys. The key bytes kept in a provider such as Vault are themselves
+encrypted ("wrapped") by a key held in an external key management service, and are unwrapped by the service when a
+key is first used, so a copy of the secret store alone does not reveal any data keys.
+
+A Provider decorates a vault.KeyMaterialProvider with a KeyWrapper. HTTPWrapper talks to services exposing the common
+KMS Encrypt/Decrypt JSON API, and package kmstest provides a local fake of such a service for tests.
+*/
+package kms
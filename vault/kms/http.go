@@ -0,0 +1,119 @@
+package kms
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/xordataexchange/superdog"
+)
+
+var _ KeyWrapper = &HTTPWrapper{}
+
+// HTTPWrapper is a KeyWrapper calling a key management service over HTTP. Keys are wrapped by POSTing
+//
+//	{"KeyId": "...", "Plaintext": "<base64>"}
+//
+// to URL/encrypt, which answers {"KeyId": "...", "CiphertextBlob": "<base64>"}, and unwrapped by POSTing
+//
+//	{"KeyId": "...", "CiphertextBlob": "<base64>"}
+//
+// to URL/decrypt, which answers {"KeyId": "...", "Plaintext": "<base64>"}.
+type HTTPWrapper struct {
+	URL    string      // Base URL of the service
+	Header http.Header // Sent with every request, e.g. an Authorization header
+	Client *http.Client
+}
+
+// Error is returned when the service answers with a status other than 200. Server errors, status 500 and above, are
+// wrapped in a *superdog.Error with superdog.ErrProviderUnavailable.
+type Error struct {
+	StatusCode int
+	Type       string `json:"__type"`
+	Message    string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	if e.Type == "" {
+		return fmt.Sprintf("KMS request failed with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("KMS request failed with status %d: %s: %s", e.StatusCode, e.Type, e.Message)
+}
+
+// NewHTTPWrapper returns an HTTPWrapper for the service at url, using http.DefaultClient.
+func NewHTTPWrapper(url string) *HTTPWrapper {
+	return &HTTPWrapper{URL: url, Header: make(http.Header)}
+}
+
+type request struct {
+	KeyID          string `json:"KeyId"`
+	Plaintext      []byte `json:",omitempty"`
+	CiphertextBlob []byte `json:",omitempty"`
+}
+
+type response struct {
+	KeyID          string `json:"KeyId"`
+	Plaintext      []byte
+	CiphertextBlob []byte
+}
+
+// Wrap encrypts key with the service's key keyID.
+func (w *HTTPWrapper) Wrap(keyID string, key []byte) ([]byte, error) {
+	resp, err := w.call("encrypt", request{KeyID: keyID, Plaintext: key})
+	if err != nil {
+		return nil, err
+	}
+	return resp.CiphertextBlob, nil
+}
+
+// Unwrap decrypts wrapped with the service's key keyID.
+func (w *HTTPWrapper) Unwrap(keyID string, wrapped []byte) ([]byte, error) {
+	resp, err := w.call("decrypt", request{KeyID: keyID, CiphertextBlob: wrapped})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Plaintext, nil
+}
+
+func (w *HTTPWrapper) call(op string, body request) (*response, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimRight(w.URL, "/")+"/"+op, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range w.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	c := w.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		return nil, &superdog.Error{Err: superdog.ErrProviderUnavailable, Cause: err}
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		e := &Error{StatusCode: res.StatusCode}
+		json.NewDecoder(res.Body).Decode(e)
+		if res.StatusCode >= http.StatusInternalServerError {
+			return nil, &superdog.Error{Err: superdog.ErrProviderUnavailable, Cause: e}
+		}
+		return nil, e
+	}
+
+	var resp response
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
@@ -0,0 +1,156 @@
+package kms
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xordataexchange/superdog"
+	"github.com/xordataexchange/superdog/internal/flight"
+	"github.com/xordataexchange/superdog/vault"
+)
+
+// KeyWrapper encrypts and decrypts key material with a key that never leaves the key management service.
+type KeyWrapper interface {
+	Wrap(keyID string, key []byte) ([]byte, error)
+	Unwrap(keyID string, wrapped []byte) ([]byte, error)
+}
+
+var _ superdog.KeyProvider = &Provider{}
+
+// metricsName is the provider name reported to the Metrics.
+const metricsName = "kms"
+
+// DefaultKeyTTL is the KeyTTL of a Provider returned by New.
+const DefaultKeyTTL = 10 * time.Minute
+
+// Provider is a KeyProvider whose keys are stored wrapped, and are unwrapped on first use.
+// Unwrapped keys are kept in memory for KeyTTL, so the key management service is called about once per key version
+// and TTL, and concurrent lookups of the same key version share one call.
+type Provider struct {
+	// KeyTTL is how long an unwrapped key is cached before it is unwrapped again, so a revocation of the wrapping key
+	// in the key management service is seen. Zero caches keys until they are purged. New sets it to DefaultKeyTTL.
+	KeyTTL time.Duration
+
+	// Metrics receives cache lookups and unwrap measurements. Nil uses superdog.DefaultMetrics.
+	Metrics superdog.Metrics
+
+	source  vault.KeyMaterialProvider
+	wrapper KeyWrapper
+	keyID   string
+
+	l       sync.Mutex
+	cache   map[string]cachedKey
+	flights flight.Group
+}
+
+// cachedKey is an unwrapped key and when it was unwrapped.
+type cachedKey struct {
+	key     *superdog.Key
+	fetched time.Time
+}
+
+// New returns a Provider reading wrapped keys from source and unwrapping them with the wrapper's key keyID.
+func New(source vault.KeyMaterialProvider, wrapper KeyWrapper, keyID string) *Provider {
+	return &Provider{
+		KeyTTL:  DefaultKeyTTL,
+		source:  source,
+		wrapper: wrapper,
+		keyID:   keyID,
+		cache:   make(map[string]cachedKey),
+	}
+}
+
+// GetKey reads the wrapped key from the source and returns it unwrapped.
+func (p *Provider) GetKey(prefix string, version uint64) (*superdog.Key, error) {
+	ckey := prefix + "/" + strconv.FormatUint(version, 10)
+	p.l.Lock()
+	c, ok := p.cache[ckey]
+	hit := ok && (p.KeyTTL <= 0 || time.Since(c.fetched) < p.KeyTTL)
+	p.l.Unlock()
+	p.metrics().CacheLookup(metricsName, "GetKey", prefix, hit)
+	if hit {
+		return c.key, nil
+	}
+
+	k, err := p.flights.Do(ckey, func() (interface{}, error) {
+		k, err := p.unwrap(prefix, version)
+		if err != nil {
+			return nil, err
+		}
+
+		p.l.Lock()
+		old, ok := p.cache[ckey]
+		p.cache[ckey] = cachedKey{key: k, fetched: time.Now()}
+		p.l.Unlock()
+		if ok {
+			// callers still holding the expired key fetch it again
+			old.key.Destroy()
+		}
+		return k, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return k.(*superdog.Key), nil
+}
+
+// metrics returns the Metrics measurements are reported to.
+func (p *Provider) metrics() superdog.Metrics {
+	if p.Metrics != nil {
+		return p.Metrics
+	}
+	return superdog.DefaultMetrics
+}
+
+// unwrap reads a key version from the source and unwraps it.
+func (p *Provider) unwrap(prefix string, version uint64) (*superdog.Key, error) {
+	m, err := p.source.GetKeyMaterial(prefix, version)
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	key, err := p.wrapper.Unwrap(p.keyID, m.Key)
+	p.metrics().ProviderRequest(metricsName, "Unwrap", prefix, time.Since(start), err)
+	if err != nil {
+		return nil, err
+	}
+	defer superdog.Wipe(key)
+	return m.NewKey(key)
+}
+
+// Purge drops the unwrapped keys of prefix and destroys them. Keys already returned by GetKey stop working;
+// superdog.Encrypt and Decrypt fetch them again.
+func (p *Provider) Purge(prefix string) {
+	p.purge(func(ckey string) bool {
+		return ckey[:strings.LastIndexByte(ckey, '/')] == prefix
+	})
+}
+
+// Close purges every unwrapped key. The Provider can still be used, unwrapping keys again.
+func (p *Provider) Close() error {
+	p.purge(func(string) bool { return true })
+	return nil
+}
+
+func (p *Provider) purge(match func(ckey string) bool) {
+	p.l.Lock()
+	defer p.l.Unlock()
+	for ckey, c := range p.cache {
+		if match(ckey) {
+			c.key.Destroy()
+			delete(p.cache, ckey)
+		}
+	}
+}
+
+// CurrentKeyVersion returns the current key version from the source.
+func (p *Provider) CurrentKeyVersion(prefix string) (uint64, error) {
+	return p.source.CurrentKeyVersion(prefix)
+}
+
+// Wrap wraps key with the provider's key, for storing a new key version in the source.
+func (p *Provider) Wrap(key []byte) ([]byte, error) {
+	return p.wrapper.Wrap(p.keyID, key)
+}
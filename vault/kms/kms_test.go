@@ -0,0 +1,209 @@
+package kms
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xordataexchange/superdog"
+	"github.com/xordataexchange/superdog/vault"
+	"github.com/xordataexchange/superdog/vault/kms/kmstest"
+)
+
+// store is a KeyMaterialProvider holding wrapped keys in memory.
+type store map[uint64][]byte
+
+func (s store) GetKeyMaterial(prefix string, version uint64) (*vault.KeyMaterial, error) {
+	k, ok := s[version]
+	if !ok {
+		return nil, superdog.ErrKeyNotFound
+	}
+	return &vault.KeyMaterial{Version: version, Cipher: superdog.AES, CipherBlockMode: superdog.GCM, Key: k}, nil
+}
+
+func (s store) CurrentKeyVersion(prefix string) (uint64, error) {
+	return uint64(len(s)), nil
+}
+
+func TestProviderUnwrapsKeys(t *testing.T) {
+	srv := kmstest.NewServer()
+	defer srv.Close()
+	srv.Token = "secret"
+	srv.CreateKey("kek")
+
+	w := NewHTTPWrapper(srv.URL)
+	w.Header.Set("Authorization", "Bearer secret")
+
+	src := store{}
+	p := New(src, w, "kek")
+
+	key := bytes.Repeat([]byte{7}, 32)
+	wrapped, err := p.Wrap(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(wrapped, key) {
+		t.Fatal("Expected key to be wrapped")
+	}
+	src[1] = wrapped
+
+	k, err := p.GetKey("ssn", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(k.Bytes(), key) || k.CipherBlockMode != superdog.GCM {
+		t.Fatal("Expected unwrapped key")
+	}
+
+	p.GetKey("ssn", 1)
+	if n := srv.Calls("decrypt"); n != 1 {
+		t.Fatal("Expected unwrapped key to be cached, got decrypt calls", n)
+	}
+
+	if _, err := p.GetKey("ssn", 2); err != superdog.ErrKeyNotFound {
+		t.Fatal("Expected key not found error, got", err)
+	}
+}
+
+func TestProviderCache(t *testing.T) {
+	srv := kmstest.NewServer()
+	defer srv.Close()
+	srv.CreateKey("kek")
+
+	src := store{}
+	p := New(src, NewHTTPWrapper(srv.URL), "kek")
+	wrapped, err := p.Wrap(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src[1] = wrapped
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.GetKey("ssn", 1)
+		}()
+	}
+	wg.Wait()
+	if n := srv.Calls("decrypt"); n != 1 {
+		t.Fatal("Expected concurrent misses to share one unwrap, got decrypt calls", n)
+	}
+
+	k, _ := p.GetKey("ssn", 1)
+	p.KeyTTL = time.Millisecond
+	time.Sleep(5 * time.Millisecond)
+	k2, err := p.GetKey("ssn", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := srv.Calls("decrypt"); n != 2 {
+		t.Fatal("Expected expired key to be unwrapped again, got decrypt calls", n)
+	}
+	if _, err := k.Encrypt(nil, []byte("value")); err != superdog.ErrKeyDestroyed {
+		t.Fatal("Expected expired key to be destroyed, got", err)
+	}
+
+	p.KeyTTL = 0
+	p.Purge("ssn")
+	if _, err := k2.Encrypt(nil, []byte("value")); err != superdog.ErrKeyDestroyed {
+		t.Fatal("Expected purged key to be destroyed, got", err)
+	}
+	p.GetKey("ssn", 1)
+	if n := srv.Calls("decrypt"); n != 3 {
+		t.Fatal("Expected purged key to be unwrapped again, got decrypt calls", n)
+	}
+}
+
+func TestHTTPWrapperErrors(t *testing.T) {
+	srv := kmstest.NewServer()
+	defer srv.Close()
+	srv.CreateKey("one")
+	srv.CreateKey("two")
+
+	w := NewHTTPWrapper(srv.URL)
+	wrapped, err := w.Wrap("one", []byte("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = w.Unwrap("two", wrapped)
+	if e, ok := err.(*Error); !ok || e.Type != "InvalidCiphertextException" {
+		t.Fatal("Expected invalid ciphertext error for the wrong key, got", err)
+	}
+
+	_, err = w.Wrap("missing", []byte("key"))
+	if e, ok := err.(*Error); !ok || e.Type != "NotFoundException" {
+		t.Fatal("Expected not found error, got", err)
+	}
+
+	srv.Token = "secret"
+	_, err = w.Unwrap("one", wrapped)
+	if e, ok := err.(*Error); !ok || e.StatusCode != 401 {
+		t.Fatal("Expected access denied error, got", err)
+	}
+}
+
+func TestHTTPWrapperUnavailable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	_, err := NewHTTPWrapper(srv.URL).Unwrap("one", []byte("wrapped"))
+	var e *Error
+	if !errors.Is(err, superdog.ErrProviderUnavailable) || !errors.As(err, &e) || e.StatusCode != http.StatusServiceUnavailable {
+		t.Fatal("Expected provider unavailable error for a server error, got", err)
+	}
+
+	srv.Close()
+	if _, err := NewHTTPWrapper(srv.URL).Unwrap("one", []byte("wrapped")); !errors.Is(err, superdog.ErrProviderUnavailable) {
+		t.Fatal("Expected provider unavailable error for an unreachable service, got", err)
+	}
+}
+
+// lookups is a superdog.Metrics counting cache lookups and unwraps.
+type lookups struct {
+	superdog.NopMetrics
+	l               sync.Mutex
+	hits, unwrapped int
+}
+
+func (m *lookups) CacheLookup(provider, op, prefix string, hit bool) {
+	m.l.Lock()
+	defer m.l.Unlock()
+	if hit {
+		m.hits++
+	}
+}
+
+func (m *lookups) ProviderRequest(provider, op, prefix string, d time.Duration, err error) {
+	m.l.Lock()
+	defer m.l.Unlock()
+	m.unwrapped++
+}
+
+func TestProviderMetrics(t *testing.T) {
+	srv := kmstest.NewServer()
+	defer srv.Close()
+	srv.CreateKey("kek")
+
+	src := store{}
+	p := New(src, NewHTTPWrapper(srv.URL), "kek")
+	m := &lookups{}
+	p.Metrics = m
+	wrapped, err := p.Wrap(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src[1] = wrapped
+
+	p.GetKey("ssn", 1)
+	p.GetKey("ssn", 1)
+	if m.hits != 1 || m.unwrapped != 1 {
+		t.Fatal("Expected one cache hit and one unwrap to be reported, got", m.hits, m.unwrapped)
+	}
+}
@@ -0,0 +1,9 @@
+/*
+See LICENSE file for license details
+Copyright (c) 2015 XOR Data Exchange, Inc.
+
+
+Package kmstest provides a local fake of a key management service exposing the KMS Encrypt/Decrypt JSON API used by
+kms.HTTPWrapper, so envelope encryption can be tested without a cloud account.
+*/
+package kmstest
@@ -0,0 +1,142 @@
+package kmstest
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// Server is a fake key management service holding AES-256-GCM keys in memory.
+// Ciphertexts are the GCM nonce followed by the sealed plaintext, with the key ID as additional data.
+type Server struct {
+	*httptest.Server
+
+	// Token, if set, must be sent as "Authorization: Bearer <Token>" with every request.
+	Token string
+
+	l     sync.Mutex
+	keys  map[string]cipher.AEAD
+	calls map[string]int
+}
+
+type request struct {
+	KeyID          string `json:"KeyId"`
+	Plaintext      []byte
+	CiphertextBlob []byte
+}
+
+type response struct {
+	KeyID          string `json:"KeyId"`
+	Plaintext      []byte `json:",omitempty"`
+	CiphertextBlob []byte `json:",omitempty"`
+}
+
+// NewServer starts and returns a new Server with no keys. The caller should call Close when finished.
+func NewServer() *Server {
+	s := &Server{
+		keys:  make(map[string]cipher.AEAD),
+		calls: make(map[string]int),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/encrypt", s.encrypt)
+	mux.HandleFunc("/decrypt", s.decrypt)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// CreateKey creates a random key with the given ID, replacing any existing key with that ID.
+func (s *Server) CreateKey(id string) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		panic(err)
+	}
+	block, _ := aes.NewCipher(key)
+	aead, _ := cipher.NewGCM(block)
+
+	s.l.Lock()
+	s.keys[id] = aead
+	s.l.Unlock()
+}
+
+// Calls returns the number of requests made to op, "encrypt" or "decrypt".
+func (s *Server) Calls(op string) int {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.calls[op]
+}
+
+func (s *Server) encrypt(w http.ResponseWriter, r *http.Request) {
+	req, aead, ok := s.parse(w, r, "encrypt")
+	if !ok {
+		return
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		writeError(w, http.StatusInternalServerError, "KMSInternalException", err.Error())
+		return
+	}
+	blob := aead.Seal(nonce, nonce, req.Plaintext, []byte(req.KeyID))
+	json.NewEncoder(w).Encode(response{KeyID: req.KeyID, CiphertextBlob: blob})
+}
+
+func (s *Server) decrypt(w http.ResponseWriter, r *http.Request) {
+	req, aead, ok := s.parse(w, r, "decrypt")
+	if !ok {
+		return
+	}
+
+	blob := req.CiphertextBlob
+	if len(blob) < aead.NonceSize() {
+		writeError(w, http.StatusBadRequest, "InvalidCiphertextException", "Ciphertext is too short")
+		return
+	}
+	plain, err := aead.Open(nil, blob[:aead.NonceSize()], blob[aead.NonceSize():], []byte(req.KeyID))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidCiphertextException", "Ciphertext could not be decrypted")
+		return
+	}
+	json.NewEncoder(w).Encode(response{KeyID: req.KeyID, Plaintext: plain})
+}
+
+// parse checks the request's method and token, decodes its body and looks up its key.
+func (s *Server) parse(w http.ResponseWriter, r *http.Request, op string) (*request, cipher.AEAD, bool) {
+	s.l.Lock()
+	s.calls[op]++
+	s.l.Unlock()
+
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "UnsupportedOperationException", "Expected POST")
+		return nil, nil, false
+	}
+	if s.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.Token {
+		writeError(w, http.StatusUnauthorized, "AccessDeniedException", "Invalid token")
+		return nil, nil, false
+	}
+
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "ValidationException", err.Error())
+		return nil, nil, false
+	}
+
+	s.l.Lock()
+	aead, ok := s.keys[req.KeyID]
+	s.l.Unlock()
+	if !ok {
+		writeError(w, http.StatusBadRequest, "NotFoundException", "Key "+req.KeyID+" does not exist")
+		return nil, nil, false
+	}
+	return &req, aead, true
+}
+
+func writeError(w http.ResponseWriter, status int, typ, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"__type": typ, "message": msg})
+}
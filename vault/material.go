@@ -0,0 +1,37 @@
+package vault
+
+import (
+	"time"
+
+	"github.com/xordataexchange/superdog"
+)
+
+// KeyMaterial is a key as its provider stores it, before the bytes are turned into a superdog.Key.
+// Decorators that transform the stored bytes, such as unwrapping them with a KMS, work on KeyMaterial.
+type KeyMaterial struct {
+	Version         uint64
+	Cipher          superdog.Cipher
+	CipherBlockMode superdog.CipherBlockMode
+	Key             []byte
+
+	Created   time.Time
+	NotBefore time.Time
+	ExpiresAt time.Time
+	State     superdog.KeyState
+}
+
+// NewKey returns the key described by m, with its lifecycle metadata, using key as the key bytes.
+func (m *KeyMaterial) NewKey(key []byte) (*superdog.Key, error) {
+	k, err := superdog.NewKey(m.Version, m.Cipher, m.CipherBlockMode, key)
+	if err != nil {
+		return nil, err
+	}
+	k.Created, k.NotBefore, k.ExpiresAt, k.State = m.Created, m.NotBefore, m.ExpiresAt, m.State
+	return k, nil
+}
+
+// KeyMaterialProvider is implemented by providers that can return a key's stored bytes without interpreting them.
+type KeyMaterialProvider interface {
+	GetKeyMaterial(prefix string, version uint64) (*KeyMaterial, error)
+	CurrentKeyVersion(prefix string) (uint64, error)
+}
@@ -0,0 +1,44 @@
+package vault
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/xordataexchange/superdog"
+)
+
+// ParseKeySpec returns the key described by spec, a string of the form "<cipher>:<block mode>:<base64 key>", e.g. "AES:GCM:c2VjcmV0...".
+// It is the format used by providers that read keys from plain text, such as environment variables or mounted files.
+func ParseKeySpec(version uint64, spec string) (*superdog.Key, error) {
+	parts := strings.SplitN(strings.TrimSpace(spec), ":", 3)
+	if len(parts) != 3 {
+		return nil, errors.New("Expected <cipher>:<block mode>:<base64 key>")
+	}
+
+	c, err := superdog.ParseCipher(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	bm, err := superdog.ParseCipherBlockMode(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	key, err := DecodeBase64(parts[2])
+	if err != nil {
+		return nil, err
+	}
+
+	return superdog.NewKey(version, c, bm, key)
+}
+
+// DecodeBase64 decodes standard or URL-safe base64, padded or not.
+func DecodeBase64(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(s); err == nil {
+			return b, nil
+		}
+	}
+	return nil, errors.New("Invalid base64 encoding")
+}
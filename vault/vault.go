@@ -1,8 +1,7 @@
 package vault
 
 import (
-	"log"
-	"strconv"
+	"sync"
 
 	"github.com/xordataexchange/superdog"
 )
@@ -17,37 +16,47 @@ var _ Vault = &DevVault{}
 
 // DevVault returns hardcoded stubbed responses to remove development dependencies from a true vault. Insecure, do not use in production.
 type DevVault struct {
-	DisableWarn bool // Disable log messages when this is used
+	DisableWarn bool // Disable the warning logged the first time this is used
 	SaltVersion uint64
 	KeyVersion  uint64
+
+	// Seed and Modes configure the derived keys, as for superdog.DevDerivedKeyProvider.
+	Seed  []byte
+	Modes map[uint64]superdog.CipherBlockMode
+
+	warned sync.Once
 }
 
 func (v *DevVault) CurrentKeyVersion(prefix string) (uint64, error) {
+	if superdog.ProductionRequired() {
+		return 0, superdog.ErrDevProvider
+	}
 	return v.KeyVersion, nil
 }
 
 func (v *DevVault) CurrentSaltVersion(prefix string) (uint64, error) {
+	if superdog.ProductionRequired() {
+		return 0, superdog.ErrDevProvider
+	}
 	return v.SaltVersion, nil
 }
 
-// GetKey returns a stubbed encryption key for development purposes.
+// GetKey returns an encryption key derived for the prefix and version, for development purposes.
 func (v *DevVault) GetKey(prefix string, version uint64) (*superdog.Key, error) {
-	if !v.DisableWarn {
-		log.Println("USING DEV KEY PROVIDER!")
+	if !v.DisableWarn && !superdog.ProductionRequired() {
+		superdog.WarnDev(&v.warned, "DevVault")
 	}
-
-	if version == 1 {
-		return superdog.NewKey(version, superdog.AES, superdog.CFB, []byte("DEFAULT  KEY "))
-	}
-
-	vs := strconv.FormatUint(version, 10)
-	return superdog.NewKey(version, superdog.AES, superdog.GCM, []byte("DEFAULT  KEY DEFAULT  KEY"+vs))
+	kp := superdog.DevDerivedKeyProvider{DisableWarn: true, Seed: v.Seed, Modes: v.Modes}
+	return kp.GetKey(prefix, version)
 }
 
 // CurrentSalts returns a stubbed list of salts to be used for the given prefix
 func (v *DevVault) CurrentSalts(prefix string) ([]uint64, error) {
+	if superdog.ProductionRequired() {
+		return nil, superdog.ErrDevProvider
+	}
 	if !v.DisableWarn {
-		log.Println("USING DEV SALT PROVIDER!")
+		superdog.WarnDev(&v.warned, "DevVault")
 	}
 
 	return []uint64{v.KeyVersion}, nil
@@ -55,8 +64,11 @@ func (v *DevVault) CurrentSalts(prefix string) ([]uint64, error) {
 
 // GetSalt returns a stubbed salt to be used for the given prefix
 func (v *DevVault) GetSalt(prefix string, version uint64) ([]byte, error) {
+	if superdog.ProductionRequired() {
+		return nil, superdog.ErrDevProvider
+	}
 	if !v.DisableWarn {
-		log.Println("USING DEV SALT PROVIDER!")
+		superdog.WarnDev(&v.warned, "DevVault")
 	}
 	return []byte("DEV SALT " + prefix), nil
 }